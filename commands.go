@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/yuanying/myao/model/configs"
+)
+
+const usage = `Usage:
+  myao [flags]                        Run the Slack bot
+  myao characters lint <file>...      Validate character config files
+`
+
+// runCommand runs the subcommand given by args and returns the exit code.
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) >= 2 && args[0] == "characters" && args[1] == "lint" {
+		return lintCharacters(args[2:], stdout, stderr)
+	}
+	fmt.Fprintf(stderr, "unknown command: %v\n\n%v", strings.Join(args, " "), usage)
+	return 2
+}
+
+func lintCharacters(files []string, stdout, stderr io.Writer) int {
+	if len(files) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	code := 0
+	for _, file := range files {
+		_, err := configs.LoadFile(file)
+		if err == nil {
+			fmt.Fprintf(stdout, "%v: ok\n", file)
+			continue
+		}
+		code = 1
+
+		var errs configs.Errors
+		if !errors.As(err, &errs) {
+			fmt.Fprintf(stderr, "%v: %v\n", file, err)
+			continue
+		}
+		for _, e := range errs {
+			// Errors in the base characters are reported with their names.
+			source := file
+			if e.Source != "" {
+				source = e.Source
+			}
+			if e.Line > 0 {
+				fmt.Fprintf(stderr, "%v:%d: ", source, e.Line)
+			} else {
+				fmt.Fprintf(stderr, "%v: ", source)
+			}
+			if e.Field != "" {
+				fmt.Fprintf(stderr, "%v: ", e.Field)
+			}
+			fmt.Fprintln(stderr, e.Message)
+		}
+	}
+	return code
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"time"
 
 	"github.com/slack-go/slack"
@@ -15,10 +16,26 @@ import (
 	"k8s.io/klog/v2"
 
 	"github.com/yuanying/myao/model"
+	"github.com/yuanying/myao/model/budget"
+	"github.com/yuanying/myao/model/configs"
+	"github.com/yuanying/myao/model/embedding"
+	"github.com/yuanying/myao/model/feedback"
+	"github.com/yuanying/myao/model/knowledge"
+	"github.com/yuanying/myao/model/memory"
 	"github.com/yuanying/myao/model/myao"
-	"github.com/yuanying/myao/model/nyao"
+	"github.com/yuanying/myao/model/pipeline"
+	"github.com/yuanying/myao/model/progress"
+	"github.com/yuanying/myao/model/quiz"
+	"github.com/yuanying/myao/model/speech"
+	"github.com/yuanying/myao/model/summary"
+	"github.com/yuanying/myao/slack/channels"
 	"github.com/yuanying/myao/slack/handler"
 	"github.com/yuanying/myao/slack/handler/socket"
+	"github.com/yuanying/myao/slack/policy"
+	"github.com/yuanying/myao/slack/profiles"
+	"github.com/yuanying/myao/slack/router"
+	"github.com/yuanying/myao/slack/scheduler"
+	"github.com/yuanying/myao/slack/tutor"
 	"github.com/yuanying/myao/slack/users"
 )
 
@@ -38,7 +55,11 @@ var (
 	handlerType         string
 	character           string
 	maxDelayReplyPeriod time.Duration
+	policyFile          string
+	routingFile         string
 	persistentDir       string
+	usersRefreshPeriod  time.Duration
+	snippetLines        int
 
 	// Options for Event type handler
 	shutdownDelayPeriod time.Duration
@@ -55,6 +76,57 @@ var (
 	// Options for OpenAI Client
 	openAIAccessToken    string
 	openAIOrganizationID string
+	requestTimeout       time.Duration
+	maxRetries           int
+	fallbackModels       []string
+	overrides            configs.Overrides
+
+	// Options for rate limits and budgets
+	userRateLimit      int
+	userRateBurst      int
+	channelRateLimit   int
+	channelRateBurst   int
+	dailyTokenBudget   int
+	monthlyTokenBudget int
+	dailyCostBudget    float64
+	monthlyCostBudget  float64
+
+	// Options for speech-to-text
+	speechBackend     string
+	speechBaseURL     string
+	speechModel       string
+	speechLanguage    string
+	speechAccessToken string
+
+	// Options for long-term memories
+	embeddingBackend     string
+	embeddingBaseURL     string
+	embeddingModel       string
+	embeddingAccessToken string
+	memoryRecall         int
+
+	// Options for knowledge bases
+	knowledgeDirs          map[string]string
+	knowledgeTopK          int
+	knowledgeRefreshPeriod time.Duration
+
+	// Options for quizzes
+	quizDelivery string
+	quizChannel  string
+	quizTime     string
+	quizSize     int
+
+	// Options for feedbacks
+	positiveReactions []string
+	negativeReactions []string
+	retryReactions    []string
+
+	// Options for summaries
+	summaryHours       int
+	summaryChunkTokens int
+
+	// Options for user profiles
+	profileIdle time.Duration
 )
 
 func init() {
@@ -64,23 +136,111 @@ func init() {
 	pflag.StringVar(&character, "character", "default", "The character of this Chatbot.")
 	pflag.StringVar(&handlerType, "handler", "socket", "Type of event handler.")
 	pflag.DurationVar(&maxDelayReplyPeriod, "max-delay-reply-period", 600*time.Second, "set the time (in seconds) that the myao will wait before replying")
-	pflag.StringVar(&persistentDir, "persistent-dir", "./", "Set the directory to store persistent data")
+	pflag.StringVar(&policyFile, "policy-file", "", "Path to the YAML file of the reply policies per channel.")
+	pflag.StringVar(&routingFile, "routing-file", "", "Path to the YAML file of the rules binding channels to characters.")
+	pflag.StringVar(&persistentDir, "persistent-dir", "./", "Set the directory to store persistent data. Replicas must share it not to post the schedules twice.")
+	pflag.DurationVar(&usersRefreshPeriod, "users-refresh-period", time.Hour, "Interval to refresh the members of the workspace.")
+	pflag.IntVar(&snippetLines, "snippet-lines", 40, "Number of lines of the code blocks in replies to be uploaded as snippets. Disabled if 0.")
+
+	pflag.DurationVar(&requestTimeout, "request-timeout", 60*time.Second, "Timeout of each request to OpenAI.")
+	pflag.IntVar(&maxRetries, "max-retries", 3, "Number of retries of a request to OpenAI failed by transient errors.")
+	pflag.StringSliceVar(&fallbackModels, "fallback-models", nil, "Models tried in order if the model of the character keeps failing, e.g. gpt-4o-mini.")
+
+	overrides.Model = pflag.String("model", "", "OpenAI model overriding the model of the character.")
+	overrides.Temperature = pflag.Float32("temperature", 0, "Sampling temperature overriding the character config.")
+	overrides.MaxTokens = pflag.Int("max-tokens", 0, "Maximum number of tokens of a reply overriding the character config.")
+	overrides.TopP = pflag.Float32("top-p", 0, "Nucleus sampling probability overriding the character config.")
+	overrides.PresencePenalty = pflag.Float32("presence-penalty", 0, "Presence penalty overriding the character config.")
+	overrides.FrequencyPenalty = pflag.Float32("frequency-penalty", 0, "Frequency penalty overriding the character config.")
+	overrides.Seed = pflag.Int("seed", 0, "Sampling seed overriding the character config.")
+
+	pflag.IntVar(&userRateLimit, "user-rate-limit", 0, "Number of replies per hour allowed for each user. Unlimited if 0.")
+	pflag.IntVar(&userRateBurst, "user-rate-burst", 5, "Number of replies each user can request in a burst.")
+	pflag.IntVar(&channelRateLimit, "channel-rate-limit", 0, "Number of replies per hour allowed in each channel. Unlimited if 0.")
+	pflag.IntVar(&channelRateBurst, "channel-rate-burst", 10, "Number of replies each channel can request in a burst.")
+	pflag.IntVar(&dailyTokenBudget, "daily-token-budget", 0, "Number of OpenAI tokens allowed per day. Unlimited if 0.")
+	pflag.IntVar(&monthlyTokenBudget, "monthly-token-budget", 0, "Number of OpenAI tokens allowed per month. Unlimited if 0.")
+	pflag.Float64Var(&dailyCostBudget, "daily-cost-budget", 0, "OpenAI cost in USD allowed per day. Unlimited if 0.")
+	pflag.Float64Var(&monthlyCostBudget, "monthly-cost-budget", 0, "OpenAI cost in USD allowed per month. Unlimited if 0.")
+
+	pflag.StringVar(&speechBackend, "speech-backend", "", "Backend to transcribe audio messages (whisper or local). Transcription is disabled if empty.")
+	pflag.StringVar(&speechBaseURL, "speech-base-url", "", "Base URL of the OpenAI-compatible speech-to-text API.")
+	pflag.StringVar(&speechModel, "speech-model", "whisper-1", "Model name used to transcribe audio messages.")
+	pflag.StringVar(&speechLanguage, "speech-language", "", "Language of audio messages in ISO-639-1 format. Detected automatically if empty.")
+
+	pflag.StringVar(&embeddingBackend, "embedding-backend", "", "Backend to embed the long-term memories (openai or local). Long-term memories are disabled if empty.")
+	pflag.StringVar(&embeddingBaseURL, "embedding-base-url", "", "Base URL of the OpenAI-compatible embeddings API.")
+	pflag.StringVar(&embeddingModel, "embedding-model", "text-embedding-3-small", "Model name used to embed the long-term memories.")
+	pflag.IntVar(&memoryRecall, "memory-recall", 5, "Number of the long-term memories recalled into the prompt of each reply.")
+
+	pflag.StringToStringVar(&knowledgeDirs, "knowledge-dirs", nil, "Directories of the documents the characters answer about by character, e.g. default=./runbooks. Requires --embedding-backend.")
+	pflag.IntVar(&knowledgeTopK, "knowledge-top-k", 4, "Number of the chunks of the documents retrieved into the prompt of each reply.")
+	pflag.DurationVar(&knowledgeRefreshPeriod, "knowledge-refresh-period", 5*time.Minute, "Interval to index the documents changed.")
+
+	pflag.StringVar(&quizDelivery, "quiz-delivery", "", "How to deliver the daily quizzes made from the past corrections (dm or thread). Quizzes are disabled if empty.")
+	pflag.StringVar(&quizChannel, "quiz-channel", "", "Channel ID to post the daily thread of the quizzes in, for --quiz-delivery=thread.")
+	pflag.StringVar(&quizTime, "quiz-time", "09:00", "Local time of the day to deliver the quizzes.")
+	pflag.IntVar(&quizSize, "quiz-size", 3, "Number of the quizzes per user per day.")
+
+	pflag.StringSliceVar(&positiveReactions, "positive-reactions", []string{"+1"}, "Reactions to the replies recorded as positive feedback.")
+	pflag.StringSliceVar(&negativeReactions, "negative-reactions", []string{"-1"}, "Reactions to the replies removing the exchange from the memories as negative feedback.")
+	pflag.StringSliceVar(&retryReactions, "retry-reactions", []string{"repeat"}, "Reactions to the replies regenerating the reply.")
+
+	pflag.IntVar(&summaryHours, "summary-hours", 24, "Default number of the hours of the conversation summarized by /summarize.")
+	pflag.IntVar(&summaryChunkTokens, "summary-chunk-tokens", 6000, "Number of the tokens of the messages summarized at once. Summaries are disabled if 0.")
+
+	pflag.DurationVar(&profileIdle, "profile-idle", 10*time.Minute, "Time since the last message of a user after which the profile of the user is updated. Profiles are disabled if 0.")
 
 	pflag.StringVar(&bindAddress, "bind-address", ":8080", "Address on which to expose web interface.")
 	pflag.DurationVar(&shutdownDelayPeriod, "shutdown-wait-period", 1*time.Second, "set the time (in seconds) that the server will wait before initiating shutdown")
 	pflag.DurationVar(&shutdownGracePeriod, "shutdown-grace-period", 5*time.Second, "set the time (in seconds) that the server will wait shutdown")
 	pflag.Parse()
 
+	// Only the parameters given by the command line override the character config.
+	flags := pflag.CommandLine
+	if !flags.Changed("model") {
+		overrides.Model = nil
+	}
+	if !flags.Changed("temperature") {
+		overrides.Temperature = nil
+	}
+	if !flags.Changed("max-tokens") {
+		overrides.MaxTokens = nil
+	}
+	if !flags.Changed("top-p") {
+		overrides.TopP = nil
+	}
+	if !flags.Changed("presence-penalty") {
+		overrides.PresencePenalty = nil
+	}
+	if !flags.Changed("frequency-penalty") {
+		overrides.FrequencyPenalty = nil
+	}
+	if !flags.Changed("seed") {
+		overrides.Seed = nil
+	}
+
 	slackBotToken = os.Getenv("SLACK_BOT_TOKEN")
 	slackAppToken = os.Getenv("SLACK_APP_TOKEN")
 	slackSigningSecret = os.Getenv("SLACK_SIGNING_SECRET")
 
 	openAIAccessToken = os.Getenv("OPENAI_ACCESS_TOKEN")
 	openAIOrganizationID = os.Getenv("OPENAI_ORG_ID")
+
+	speechAccessToken = os.Getenv("SPEECH_ACCESS_TOKEN")
+	if speechAccessToken == "" {
+		speechAccessToken = openAIAccessToken
+	}
+	embeddingAccessToken = os.Getenv("EMBEDDING_ACCESS_TOKEN")
+	if embeddingAccessToken == "" {
+		embeddingAccessToken = openAIAccessToken
+	}
 }
 
 func main() {
-	var bot model.Model
+	if pflag.NArg() > 0 {
+		os.Exit(runCommand(pflag.Args(), os.Stdout, os.Stderr))
+	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
@@ -90,46 +250,139 @@ func main() {
 		slackOpts = append(slackOpts, slack.OptionAppLevelToken(slackAppToken))
 	}
 	slackCli := slack.New(slackBotToken, slackOpts...)
-	slackUsers, err := users.New(slackCli)
+	slackUsers, err := users.New(ctx, slackCli, persistentDir)
 	if err != nil {
 		klog.Errorf("Failed to create slack users obj: %v", err)
 		os.Exit(1)
 	}
+	go slackUsers.Run(ctx, usersRefreshPeriod)
 
-	myaoOpts := &model.Opts{
-		OpenAIAccessToken:    openAIAccessToken,
+	slackChannels := channels.New(slackCli)
+	characterRouter, err := router.New(slackChannels, routingFile, character)
+	if err != nil {
+		klog.Errorf("Failed to load routing rules: %v", err)
+		os.Exit(1)
+	}
+
+	usageBudget := budget.New(&budget.Opts{
+		DailyTokens:   dailyTokenBudget,
+		MonthlyTokens: monthlyTokenBudget,
+		DailyCost:     dailyCostBudget,
+		MonthlyCost:   monthlyCostBudget,
+		PersistentDir: persistentDir,
+	})
+
+	embedder, err := embedding.New(&embedding.Opts{
+		Backend:              embeddingBackend,
+		BaseURL:              embeddingBaseURL,
+		Model:                embeddingModel,
+		AccessToken:          embeddingAccessToken,
 		OpenAIOrganizationID: openAIOrganizationID,
-		UsersMap:             slackUsers.Users,
-		CharacterType:        character,
-		PersistentDir:        persistentDir,
+		Budget:               usageBudget,
+	})
+	if err != nil {
+		klog.Errorf("Failed to create embedder: %v", err)
+		os.Exit(1)
 	}
 
-	switch character {
-	case "nyao":
-		bot, err = nyao.New(myaoOpts)
-	default:
-		bot, err = myao.New(myaoOpts)
+	if len(knowledgeDirs) > 0 && embedder == nil {
+		klog.Errorf("Knowledge bases require --embedding-backend")
+		os.Exit(1)
+	}
+
+	bots := map[string]model.Model{}
+	for _, c := range characterRouter.Characters() {
+		bots[c], err = newBot(ctx, c, slackUsers, usageBudget, embedder)
+		if err != nil {
+			klog.Errorf("Failed to create myao obj: %v, %v", c, err)
+			os.Exit(1)
+		}
+	}
+
+	transcriber, err := speech.New(&speech.Opts{
+		Backend:              speechBackend,
+		BaseURL:              speechBaseURL,
+		Model:                speechModel,
+		Language:             speechLanguage,
+		AccessToken:          speechAccessToken,
+		OpenAIOrganizationID: openAIOrganizationID,
+	})
+	if err != nil {
+		klog.Errorf("Failed to create speech transcriber: %v", err)
+		os.Exit(1)
+	}
+
+	quizTutor, err := newTutor(slackCli, usageBudget)
+	if err != nil {
+		klog.Errorf("Failed to create quiz tutor: %v", err)
+		os.Exit(1)
+	}
+	if quizTutor != nil {
+		go quizTutor.Run(ctx)
+	}
+
+	replyPolicy, err := policy.New(policyFile, maxDelayReplyPeriod)
+	if err != nil {
+		klog.Errorf("Failed to load reply policy: %v", err)
+		os.Exit(1)
+	}
+
+	feedbackRecorder := feedback.New(&feedback.Opts{
+		PersistentDir: persistentDir,
+		Positive:      positiveReactions,
+		Negative:      negativeReactions,
+		Retry:         retryReactions,
+	})
+
+	summarizer, err := newSummarizer(usageBudget)
+	if err != nil {
+		klog.Errorf("Failed to create summarizer: %v", err)
+		os.Exit(1)
 	}
+
+	userProfiles, err := newProfiler(slackUsers, usageBudget)
 	if err != nil {
-		klog.Errorf("Failed to create myao obj: %v", err)
+		klog.Errorf("Failed to create profiler: %v", err)
 		os.Exit(1)
 	}
+	if userProfiles != nil {
+		go userProfiles.Run(ctx)
+	}
 
 	mux := http.NewServeMux()
 
 	switch handlerType {
 	default:
 		s, err := socket.New(&handler.Opts{
-			Myao:                bot,
-			Slack:               slackCli,
-			SlackUsers:          slackUsers,
-			MaxDelayReplyPeriod: maxDelayReplyPeriod,
+			Bots:           bots,
+			Router:         characterRouter,
+			Slack:          slackCli,
+			SlackUsers:     slackUsers,
+			Channels:       slackChannels,
+			Policy:         replyPolicy,
+			Transcriber:    transcriber,
+			UserLimiter:    budget.NewLimiter(userRateLimit, userRateBurst),
+			ChannelLimiter: budget.NewLimiter(channelRateLimit, channelRateBurst),
+			Progress:       progress.New(persistentDir),
+			Tutor:          quizTutor,
+			SnippetLines:   snippetLines,
+			Feedback:       feedbackRecorder,
+			Summarizer:     summarizer,
+			SummaryHours:   summaryHours,
+			Profiles:       userProfiles,
 		})
 		if err != nil {
-			klog.Error("Failed to load socket client: %v", err)
+			klog.Errorf("Failed to load socket client: %v", err)
 			os.Exit(1)
 		}
 		go s.Run(ctx)
+
+		postScheduler, err := newScheduler(characterRouter, slackChannels, s.Announce)
+		if err != nil {
+			klog.Errorf("Failed to load schedules: %v", err)
+			os.Exit(1)
+		}
+		go postScheduler.Run(ctx)
 	}
 
 	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
@@ -162,3 +415,153 @@ func main() {
 		klog.Fatal(err.Error())
 	}
 }
+
+// newTutor creates the tutor of the quizzes, or returns nil if the quizzes are disabled.
+func newTutor(slackCli *slack.Client, usageBudget *budget.Budget) (*tutor.Tutor, error) {
+	if quizDelivery == "" {
+		return nil, nil
+	}
+	grader, err := quiz.NewGrader(&model.Opts{
+		OpenAIAccessToken:    openAIAccessToken,
+		OpenAIOrganizationID: openAIOrganizationID,
+		PersistentDir:        persistentDir,
+		Budget:               usageBudget,
+		RequestTimeout:       requestTimeout,
+		MaxRetries:           maxRetries,
+		FallbackModels:       fallbackModels,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tutor.New(&tutor.Opts{
+		Slack:    slackCli,
+		Deck:     quiz.New(persistentDir),
+		Grader:   grader,
+		Delivery: quizDelivery,
+		Channel:  quizChannel,
+		Time:     quizTime,
+		Size:     quizSize,
+	})
+}
+
+// newSummarizer creates the summarizer of the conversations, or returns nil if the summaries are disabled.
+func newSummarizer(usageBudget *budget.Budget) (*summary.Summarizer, error) {
+	if summaryChunkTokens <= 0 {
+		return nil, nil
+	}
+	return summary.New(&model.Opts{
+		OpenAIAccessToken:    openAIAccessToken,
+		OpenAIOrganizationID: openAIOrganizationID,
+		PersistentDir:        persistentDir,
+		Budget:               usageBudget,
+		RequestTimeout:       requestTimeout,
+		MaxRetries:           maxRetries,
+		FallbackModels:       fallbackModels,
+	}, summaryChunkTokens)
+}
+
+// newProfiler creates the profiler of the users, or returns nil if the profiles are disabled.
+func newProfiler(slackUsers *users.Users, usageBudget *budget.Budget) (*profiles.Profiler, error) {
+	if profileIdle <= 0 {
+		return nil, nil
+	}
+	return profiles.New(&model.Opts{
+		OpenAIAccessToken:    openAIAccessToken,
+		OpenAIOrganizationID: openAIOrganizationID,
+		PersistentDir:        persistentDir,
+		Budget:               usageBudget,
+		RequestTimeout:       requestTimeout,
+		MaxRetries:           maxRetries,
+		FallbackModels:       fallbackModels,
+	}, &profiles.Opts{
+		PersistentDir: persistentDir,
+		Users:         slackUsers,
+		Idle:          profileIdle,
+	})
+}
+
+// newScheduler collects the schedules of the characters and the routing rules.
+func newScheduler(characterRouter *router.Router, slackChannels *channels.Channels, post func(context.Context, string, string, *configs.Schedule) error) (*scheduler.Scheduler, error) {
+	var jobs []*scheduler.Job
+	for _, c := range characterRouter.Characters() {
+		config, err := configs.Load(c)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range config.Schedules {
+			jobs = append(jobs, &scheduler.Job{Character: c, Schedule: s})
+		}
+	}
+	for c, schedules := range characterRouter.Schedules() {
+		config, err := configs.Load(c)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range schedules {
+			if err := config.ParseSchedule(s); err != nil {
+				return nil, fmt.Errorf("schedule %v: %w", s.Name, err)
+			}
+			jobs = append(jobs, &scheduler.Job{Character: c, Schedule: s})
+		}
+	}
+	return scheduler.New(&scheduler.Opts{
+		PersistentDir: persistentDir,
+		Channels:      slackChannels,
+		Jobs:          jobs,
+		Post:          post,
+	})
+}
+
+// newBot creates the chatbot of the character.
+// The character given by --character stores its data in the persistent dir, and the others in its subdirectories.
+func newBot(ctx context.Context, c string, slackUsers *users.Users, usageBudget *budget.Budget, embedder embedding.Embedder) (model.Model, error) {
+	config, err := configs.Load(c)
+	if err != nil {
+		return nil, err
+	}
+	dir := persistentDir
+	if c != character {
+		dir = filepath.Join(persistentDir, c)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	myaoOpts := &model.Opts{
+		OpenAIAccessToken:    openAIAccessToken,
+		OpenAIOrganizationID: openAIOrganizationID,
+		CharacterType:        c,
+		PersistentDir:        dir,
+		Budget:               usageBudget,
+		RequestTimeout:       requestTimeout,
+		MaxRetries:           maxRetries,
+		FallbackModels:       fallbackModels,
+		Overrides:            &overrides,
+	}
+	if embedder != nil {
+		longTerm, err := memory.New(myaoOpts, &memory.Opts{Embedder: embedder, Recall: memoryRecall})
+		if err != nil {
+			return nil, err
+		}
+		myaoOpts.LongTerm = longTerm
+	}
+	if docs, ok := knowledgeDirs[c]; ok {
+		base, err := knowledge.New(&knowledge.Opts{
+			Dir:           docs,
+			PersistentDir: dir,
+			Embedder:      embedder,
+			TopK:          knowledgeTopK,
+			Interval:      knowledgeRefreshPeriod,
+		})
+		if err != nil {
+			return nil, err
+		}
+		go base.Run(ctx)
+		myaoOpts.Knowledge = base
+	}
+
+	if config.Pipeline != nil {
+		return pipeline.New(myaoOpts)
+	}
+	return myao.New(myaoOpts)
+}
@@ -0,0 +1,154 @@
+package budget
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"k8s.io/klog/v2"
+)
+
+const usageFile = "usage.json"
+
+var ErrExceeded = errors.New("budget exceeded")
+
+// Price is the USD price per 1M tokens.
+type Price struct {
+	Prompt     float64
+	Completion float64
+}
+
+// Prices is the price table of models. Dated snapshots are matched by the longest prefix.
+var Prices = map[string]Price{
+	"gpt-4o":        {Prompt: 2.50, Completion: 10.00},
+	"gpt-4o-mini":   {Prompt: 0.15, Completion: 0.60},
+	"gpt-4-turbo":   {Prompt: 10.00, Completion: 30.00},
+	"gpt-4":         {Prompt: 30.00, Completion: 60.00},
+	"gpt-3.5-turbo": {Prompt: 0.50, Completion: 1.50},
+
+	"text-embedding-3-small": {Prompt: 0.02},
+	"text-embedding-3-large": {Prompt: 0.13},
+	"text-embedding-ada-002": {Prompt: 0.10},
+}
+
+// Cost returns the USD cost of the usage of the model.
+func Cost(model string, usage openai.Usage) float64 {
+	var (
+		price Price
+		found string
+	)
+	for name, p := range Prices {
+		if strings.HasPrefix(model, name) && len(name) > len(found) {
+			price, found = p, name
+		}
+	}
+	if found == "" {
+		klog.Warningf("Price of the model is unknown: %v", model)
+	}
+	return (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1e6
+}
+
+type Opts struct {
+	// Limits are ignored if they aren't positive.
+	DailyTokens   int
+	MonthlyTokens int
+	DailyCost     float64
+	MonthlyCost   float64
+	PersistentDir string
+}
+
+// Budget accounts the usage of OpenAI and caps it per day and month.
+type Budget struct {
+	opts *Opts
+
+	// mu protects usage from concurrent access.
+	mu    sync.Mutex
+	usage usage
+}
+
+type usage struct {
+	Day         string  `json:"day"`
+	DayTokens   int     `json:"dayTokens"`
+	DayCost     float64 `json:"dayCost"`
+	Month       string  `json:"month"`
+	MonthTokens int     `json:"monthTokens"`
+	MonthCost   float64 `json:"monthCost"`
+}
+
+func New(opts *Opts) *Budget {
+	b := &Budget{opts: opts}
+	data, err := os.ReadFile(b.file())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.Errorf("Failed to read usage: %v", err)
+		}
+		return b
+	}
+	if err := json.Unmarshal(data, &b.usage); err != nil {
+		klog.Errorf("Failed to parse usage: %v", err)
+	}
+	return b
+}
+
+// Exceeded reports whether any of the limits has been reached.
+func (b *Budget) Exceeded(now time.Time) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rotate(now)
+
+	u, o := &b.usage, b.opts
+	return (o.DailyTokens > 0 && u.DayTokens >= o.DailyTokens) ||
+		(o.MonthlyTokens > 0 && u.MonthTokens >= o.MonthlyTokens) ||
+		(o.DailyCost > 0 && u.DayCost >= o.DailyCost) ||
+		(o.MonthlyCost > 0 && u.MonthCost >= o.MonthlyCost)
+}
+
+// Record adds the usage of the model to the budget.
+func (b *Budget) Record(model string, usage openai.Usage, now time.Time) {
+	if b == nil {
+		return
+	}
+	cost := Cost(model, usage)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rotate(now)
+
+	b.usage.DayTokens += usage.TotalTokens
+	b.usage.DayCost += cost
+	b.usage.MonthTokens += usage.TotalTokens
+	b.usage.MonthCost += cost
+	klog.Infof("Budget: today %v tokens, $%.4f, this month %v tokens, $%.4f",
+		b.usage.DayTokens, b.usage.DayCost, b.usage.MonthTokens, b.usage.MonthCost)
+
+	data, err := json.Marshal(&b.usage)
+	if err != nil {
+		klog.Errorf("Failed to marshal usage: %v", err)
+		return
+	}
+	if err := os.WriteFile(b.file(), data, 0644); err != nil {
+		klog.Errorf("Failed to write usage: %v", err)
+	}
+}
+
+func (b *Budget) rotate(now time.Time) {
+	day, month := now.Format("2006-01-02"), now.Format("2006-01")
+	if b.usage.Day != day {
+		b.usage.Day, b.usage.DayTokens, b.usage.DayCost = day, 0, 0
+	}
+	if b.usage.Month != month {
+		b.usage.Month, b.usage.MonthTokens, b.usage.MonthCost = month, 0, 0
+	}
+}
+
+func (b *Budget) file() string {
+	return filepath.Join(b.opts.PersistentDir, usageFile)
+}
@@ -0,0 +1,94 @@
+package budget
+
+import (
+	"sync"
+	"time"
+)
+
+// pruneInterval is the interval to remove the buckets of the users and the channels quiet for a while.
+const pruneInterval = time.Hour
+
+// Limiter is a set of token buckets keyed by user or channel.
+type Limiter struct {
+	// rate is the number of tokens added per second.
+	rate  float64
+	burst float64
+
+	// mu protects buckets from concurrent access.
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	pruned  time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a Limiter allowing perHour requests per key with bursts of up to burst requests.
+// It returns nil, which allows everything, if perHour isn't positive.
+func NewLimiter(perHour, burst int) *Limiter {
+	if perHour <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:    float64(perHour) / time.Hour.Seconds(),
+		burst:   float64(burst),
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Ready reports whether the bucket of key has a token, without taking it.
+// It's checked for all the limiters before taking from any of them.
+func (l *Limiter) Ready(key string, now time.Time) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.refill(key, now) >= 1
+}
+
+// Take takes a token from the bucket of key.
+func (l *Limiter) Take(key string, now time.Time) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now)
+	tokens := l.refill(key, now)
+	if tokens >= 1 {
+		tokens--
+	}
+	l.buckets[key] = &bucket{tokens: tokens, last: now}
+}
+
+// refill returns the tokens of the bucket of key at now. mu must be held.
+func (l *Limiter) refill(key string, now time.Time) float64 {
+	b, ok := l.buckets[key]
+	if !ok {
+		return l.burst
+	}
+	tokens := b.tokens + now.Sub(b.last).Seconds()*l.rate
+	if tokens > l.burst {
+		tokens = l.burst
+	}
+	return tokens
+}
+
+// prune removes the buckets refilled to the burst, which are the same as the ones not created yet. mu must be held.
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < pruneInterval {
+		return
+	}
+	l.pruned = now
+	for key := range l.buckets {
+		if l.refill(key, now) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
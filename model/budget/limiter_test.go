@@ -0,0 +1,55 @@
+package budget
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	users := NewLimiter(60, 2)
+	channels := NewLimiter(60, 1)
+	allow := func(user, channel string, now time.Time) bool {
+		if !users.Ready(user, now) || !channels.Ready(channel, now) {
+			return false
+		}
+		users.Take(user, now)
+		channels.Take(channel, now)
+		return true
+	}
+
+	tests := []struct {
+		name    string
+		user    string
+		channel string
+		after   time.Duration
+		want    bool
+	}{
+		{name: "first", user: "alice", channel: "general", want: true},
+		{name: "channel denies", user: "alice", channel: "general", want: false},
+		{name: "user keeps token denied by channel", user: "alice", channel: "random", want: true},
+		{name: "user empty", user: "alice", channel: "english", want: false},
+		{name: "other user", user: "bob", channel: "english", want: true},
+		{name: "refilled", user: "alice", channel: "general", after: time.Minute, want: true},
+	}
+	now := start
+	for _, tt := range tests {
+		now = now.Add(tt.after)
+		if got := allow(tt.user, tt.channel, now); got != tt.want {
+			t.Errorf("%v: allow(%v, %v) = %v, want %v", tt.name, tt.user, tt.channel, got, tt.want)
+		}
+	}
+
+	now = now.Add(pruneInterval)
+	users.Take("carol", now)
+	if _, ok := users.buckets["alice"]; ok {
+		t.Errorf("bucket of alice isn't pruned")
+	}
+	if _, ok := users.buckets["carol"]; !ok {
+		t.Errorf("bucket of carol is pruned")
+	}
+	var nilLimiter *Limiter
+	if !nilLimiter.Ready("alice", now) {
+		t.Errorf("nil limiter denies")
+	}
+}
@@ -2,9 +2,15 @@ package configs
 
 import (
 	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
 
 	"gopkg.in/yaml.v3"
-	"k8s.io/klog/v2"
+
+	"github.com/yuanying/myao/model/prompt"
 )
 
 var (
@@ -18,56 +24,160 @@ var (
 	nyaoConfig []byte
 	//go:embed english_teaching_system.yaml
 	englishTeachingSystemConfig []byte
+	//go:embed quiz_grader.yaml
+	quizGraderConfig []byte
+	//go:embed summarizer.yaml
+	summarizerConfig []byte
+	//go:embed memorizer.yaml
+	memorizerConfig []byte
+	//go:embed profiler.yaml
+	profilerConfig []byte
+	//go:embed fragments/fragments.yaml
+	fragmentsConfig []byte
+
+	// builtin are the characters by name, which can be extended by other characters.
+	builtin = map[string][]byte{
+		"default":                 defaultConfig,
+		"llm-teacher":             llmTeacherConfig,
+		"english-teacher":         englishTeacherConfig,
+		"nyao":                    nyaoConfig,
+		"english-teaching-system": englishTeachingSystemConfig,
+		"quiz-grader":             quizGraderConfig,
+		"summarizer":              summarizerConfig,
+		"memorizer":               memorizerConfig,
+		"profiler":                profilerConfig,
+	}
+	// fragments are the prompt fragments shared by all characters.
+	fragments = map[string]string{}
 )
 
+func init() {
+	if err := yaml.Unmarshal(fragmentsConfig, &fragments); err != nil {
+		panic(err)
+	}
+}
+
 type Message struct {
 	Role    string `yaml:"role"`
 	Content string `yaml:"content"`
 }
 
+// Config is the character config.
+// SystemText, InitText, SummaryText and TextFormat are text/template templates rendered with prompt.Vars.
 type Config struct {
+	// Extends is the base character, either a builtin character name or a YAML file path relative to this file.
+	// The fields of this character override the base.
+	Extends string `yaml:"extends"`
+	// Fragments are the prompt fragments available in addition to the shared ones.
+	Fragments map[string]string `yaml:"fragments"`
+
 	Name        string  `yaml:"name"`
 	SystemText  string  `yaml:"systemText"`
 	InitText    string  `yaml:"initText"`
 	ErrorText   string  `yaml:"errorText"`
+	LimitText   string  `yaml:"limitText"`
 	SummaryText string  `yaml:"summaryText"`
 	Temperature float32 `yaml:"temperature"`
 	TextFormat  string  `yaml:"textFormat"`
+	// Timezone is the IANA timezone of the time in the prompts. The local timezone is used if empty.
+	Timezone string `yaml:"timezone"`
+	// Timeout is the deadline of each reply including retries. Unlimited if empty.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Model is the OpenAI model of the character. "gpt-4o" is used if empty.
+	Model            string   `yaml:"model"`
+	MaxTokens        int      `yaml:"maxTokens"`
+	TopP             float32  `yaml:"topP"`
+	PresencePenalty  float32  `yaml:"presencePenalty"`
+	FrequencyPenalty float32  `yaml:"frequencyPenalty"`
+	Stop             []string `yaml:"stop"`
+	Seed             *int     `yaml:"seed"`
+	// ResponseFormat is either "text" or "json_object".
+	ResponseFormat string `yaml:"responseFormat"`
 
 	InitConversations []Message `yaml:"initConversations"`
+
+	// Pipeline replies by the stages instead of the character itself if set.
+	Pipeline *Pipeline `yaml:"pipeline"`
+	// Schedules are the posts of the character started by itself.
+	Schedules []*Schedule `yaml:"schedules"`
+
+	location  *time.Location
+	templates map[string]*template.Template
 }
 
-func Load(character string) (*Config, error) {
-	configYaml := defaultConfig
+// Overrides are the parameters given by the command line, which take precedence over the character config.
+type Overrides struct {
+	Model            *string
+	Temperature      *float32
+	MaxTokens        *int
+	TopP             *float32
+	PresencePenalty  *float32
+	FrequencyPenalty *float32
+	Seed             *int
+}
 
-	switch character {
-	case "english-teacher":
-		configYaml = englishTeacherConfig
-	case "llm-teacher":
-		configYaml = llmTeacherConfig
+func (o *Overrides) Apply(config *Config) {
+	if o == nil {
+		return
+	}
+	if o.Model != nil {
+		config.Model = *o.Model
+	}
+	if o.Temperature != nil {
+		config.Temperature = *o.Temperature
+	}
+	if o.MaxTokens != nil {
+		config.MaxTokens = *o.MaxTokens
+	}
+	if o.TopP != nil {
+		config.TopP = *o.TopP
+	}
+	if o.PresencePenalty != nil {
+		config.PresencePenalty = *o.PresencePenalty
+	}
+	if o.FrequencyPenalty != nil {
+		config.FrequencyPenalty = *o.FrequencyPenalty
+	}
+	if o.Seed != nil {
+		config.Seed = o.Seed
 	}
-
-	return load(configYaml)
 }
 
-func LoadNyao() (*Config, *Config, error) {
-	nyao, err := load(nyaoConfig)
-	if err != nil {
-		klog.Infof("Failed to load nyao")
-		return nil, nil, err
+func Load(character string) (*Config, error) {
+	data, ok := builtin[character]
+	if !ok {
+		return nil, fmt.Errorf("unknown character %q", character)
 	}
+	return parse(data, character)
+}
 
-	system, err := load(englishTeachingSystemConfig)
+// LoadFile loads the character config from file.
+func LoadFile(file string) (*Config, error) {
+	data, err := os.ReadFile(file)
 	if err != nil {
-		klog.Infof("Failed to load nyao system")
-		return nil, nil, err
+		return nil, err
 	}
+	return parse(data, filepath.Clean(file))
+}
+
+// Location returns the timezone of the character.
+func (c *Config) Location() *time.Location {
+	return c.location
+}
+
+func (c *Config) RenderSystemText(vars *prompt.Vars) string {
+	return prompt.Render(c.templates["systemText"], vars)
+}
+
+func (c *Config) RenderInitText(vars *prompt.Vars) string {
+	return prompt.Render(c.templates["initText"], vars)
+}
 
-	return nyao, system, nil
+func (c *Config) RenderSummaryText(vars *prompt.Vars) string {
+	return prompt.Render(c.templates["summaryText"], vars)
 }
 
-func load(configYaml []byte) (config *Config, err error) {
-	config = &Config{}
-	err = yaml.Unmarshal(configYaml, config)
-	return
+func (c *Config) RenderTextFormat(vars *prompt.Vars) string {
+	return prompt.Render(c.templates["textFormat"], vars)
 }
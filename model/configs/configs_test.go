@@ -0,0 +1,41 @@
+package configs
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/yuanying/myao/model/prompt"
+)
+
+func TestLoadBuiltin(t *testing.T) {
+	var names []string
+	for name := range builtin {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			config, err := Load(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.RenderSystemText(&prompt.Vars{}) == "" {
+				t.Errorf("systemText is empty")
+			}
+			if config.Pipeline == nil {
+				return
+			}
+			vars := &prompt.StageVars{Text: "Nick: hello", Raw: "hello", Outputs: map[string]string{}}
+			for _, s := range config.Pipeline.Stages {
+				if s.RenderInput(vars) == "" {
+					t.Errorf("input of stage %v is empty", s.Name)
+				}
+				vars.Outputs[s.Name] = "output of " + s.Name
+			}
+			if output := config.Pipeline.RenderOutput(vars); !strings.Contains(output, "output of ") {
+				t.Errorf("output = %q, want the output of a stage", output)
+			}
+		})
+	}
+}
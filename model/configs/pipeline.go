@@ -0,0 +1,182 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"text/template"
+
+	"github.com/yuanying/myao/model/prompt"
+)
+
+const (
+	// MemoryConversation stages remember the conversation like a character.
+	MemoryConversation = "conversation"
+	// MemoryNone stages only see the system text, the initConversations and the input.
+	MemoryNone = "none"
+
+	// FormatText stages output the reply as it is.
+	FormatText = "text"
+	// FormatCorrection stages output the grammar correction of the message as JSON.
+	FormatCorrection = "correction"
+
+	defaultStageInput = "{{.Text}}"
+)
+
+// Pipeline replies by the stages in order instead of the character itself.
+// Input and Output are text/template templates rendered with prompt.StageVars.
+type Pipeline struct {
+	Stages []*Stage `yaml:"stages"`
+	// Output renders the reply from the outputs of the stages. The output of the last stage is used if empty.
+	Output string `yaml:"output"`
+
+	output *template.Template
+}
+
+// Stage is a step of the pipeline replying by a character.
+type Stage struct {
+	// Name identifies the output of the stage in the templates.
+	Name string `yaml:"name"`
+	// Character is either a builtin character name or a YAML file path relative to this file.
+	// The character having the pipeline is used if empty.
+	Character string `yaml:"character"`
+	// Memory is either "conversation" or "none". "conversation" is used if empty.
+	Memory string `yaml:"memory"`
+	// Input renders the message to the character. "{{.Text}}" is used if empty.
+	Input string `yaml:"input"`
+	// Parallel runs the stage concurrently with the previous stage.
+	Parallel bool `yaml:"parallel"`
+	// Format is either "text" or "correction". "text" is used if empty.
+	// The correction is rendered separately from the reply, and its output in the templates is the reply in the correction,
+	// or the correction in text if it has no reply.
+	Format string `yaml:"format"`
+
+	config *Config
+	input  *template.Template
+}
+
+// Config returns the character of the stage.
+func (s *Stage) Config() *Config {
+	return s.config
+}
+
+// Remembers returns true if the stage remembers the conversation.
+func (s *Stage) Remembers() bool {
+	return s.Memory != MemoryNone
+}
+
+func (s *Stage) RenderInput(vars *prompt.StageVars) string {
+	return prompt.Render(s.input, vars)
+}
+
+func (p *Pipeline) RenderOutput(vars *prompt.StageVars) string {
+	if p.output == nil {
+		return vars.Outputs[p.Stages[len(p.Stages)-1].Name]
+	}
+	return prompt.Render(p.output, vars)
+}
+
+// Groups returns the stages grouped by the ones running concurrently, in order.
+func (p *Pipeline) Groups() [][]*Stage {
+	var groups [][]*Stage
+	for _, s := range p.Stages {
+		if s.Parallel && len(groups) > 0 {
+			groups[len(groups)-1] = append(groups[len(groups)-1], s)
+			continue
+		}
+		groups = append(groups, []*Stage{s})
+	}
+	return groups
+}
+
+// validatePipeline checks the stages of the pipeline, and loads their characters.
+// name is the name of the config to resolve the characters relative to.
+func (c *Config) validatePipeline(name string, nodes map[string]fieldNode) Errors {
+	p := c.Pipeline
+	var errs Errors
+	fail := func(format string, args ...interface{}) {
+		e := &FieldError{Field: "pipeline", Message: fmt.Sprintf(format, args...)}
+		if n, ok := nodes["pipeline"]; ok {
+			e.Source, e.Line = n.source, n.node.Line
+		}
+		errs = append(errs, e)
+	}
+
+	if len(p.Stages) == 0 {
+		fail("stages are required")
+		return errs
+	}
+	names := map[string]bool{}
+	for i, s := range p.Stages {
+		switch {
+		case s.Name == "":
+			fail("name of stage #%d is required", i)
+		case names[s.Name]:
+			fail("stage %v is duplicated", s.Name)
+		}
+		names[s.Name] = true
+
+		switch s.Memory {
+		case "", MemoryConversation, MemoryNone:
+		default:
+			fail("memory of stage %v must be either conversation or none: %q", s.Name, s.Memory)
+		}
+
+		switch s.Format {
+		case "", FormatText, FormatCorrection:
+		default:
+			fail("format of stage %v must be either text or correction: %q", s.Name, s.Format)
+		}
+
+		input := s.Input
+		if input == "" {
+			input = defaultStageInput
+		}
+		t, err := prompt.ParseStage(s.Name, input)
+		if err != nil {
+			fail("input of stage %v: %v", s.Name, err)
+		}
+		s.input = t
+
+		if s.Character == "" {
+			s.config = c
+			continue
+		}
+		ref, data, err := resolve(s.Character, name)
+		if err != nil {
+			fail("character of stage %v: %v", s.Name, err)
+			continue
+		}
+		// The characters of the stages can't have pipelines, so they're parsed without loading their stages.
+		config, err := parseConfig(data, ref, false)
+		var stageErrs Errors
+		switch {
+		case errors.As(err, &stageErrs):
+			for _, e := range stageErrs {
+				if e.Source == "" {
+					e.Source = ref
+				}
+				errs = append(errs, e)
+			}
+		case err != nil:
+			fail("character of stage %v: %v", s.Name, err)
+		case config.Pipeline != nil:
+			fail("character of stage %v must not have a pipeline: %v", s.Name, s.Character)
+		default:
+			s.config = config
+		}
+	}
+	for _, s := range p.Stages {
+		if s.Format == FormatCorrection && s.config != nil && s.config.ResponseFormat != "json_object" {
+			fail("character of stage %v must have responseFormat json_object for the correction format", s.Name)
+		}
+	}
+
+	if p.Output != "" {
+		t, err := prompt.ParseStage("output", p.Output)
+		if err != nil {
+			fail("output: %v", err)
+		}
+		p.output = t
+	}
+	return errs
+}
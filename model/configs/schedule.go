@@ -0,0 +1,114 @@
+package configs
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/yuanying/myao/model/prompt"
+)
+
+// Schedule makes the character post in the channel periodically.
+type Schedule struct {
+	// Name identifies the schedule in the persistent dir, so it must be unique among the characters.
+	Name string `yaml:"name"`
+	// Cron is the standard cron expression, e.g. "0 9 * * 1-5" or "@daily", in the timezone of the character.
+	Cron string `yaml:"cron"`
+	// Channel is the channel ID, or the channel name prefixed by "#".
+	Channel string `yaml:"channel"`
+	// Prompt is the template of the message asking the character to post, rendered with prompt.Vars.
+	// InitText is used if empty.
+	Prompt string `yaml:"prompt"`
+	// Summary is the hours of the conversation in the channel to post the digest of, instead of the reply to the prompt.
+	Summary int `yaml:"summary"`
+
+	schedule cron.Schedule
+	template *template.Template
+	location *time.Location
+}
+
+// Next returns the next time of the schedule after t.
+func (s *Schedule) Next(t time.Time) time.Time {
+	return s.schedule.Next(t)
+}
+
+// RenderPrompt renders the message asking the character to post at the current time.
+func (s *Schedule) RenderPrompt(vars *prompt.Vars) string {
+	v := *vars
+	v.SetTime(time.Now(), s.location)
+	return prompt.Render(s.template, &v)
+}
+
+// ParseSchedule parses the cron expression and the prompt of the schedule of the character.
+func (c *Config) ParseSchedule(s *Schedule) error {
+	if s.Channel == "" {
+		return fmt.Errorf("channel is required")
+	}
+	schedule, err := cron.ParseStandard(s.Cron)
+	if err != nil {
+		return fmt.Errorf("cron: %w", err)
+	}
+	// The expressions without CRON_TZ are in the timezone of the character.
+	if spec, ok := schedule.(*cron.SpecSchedule); ok && !strings.HasPrefix(s.Cron, "CRON_TZ=") && !strings.HasPrefix(s.Cron, "TZ=") {
+		spec.Location = c.location
+	}
+	switch {
+	case s.Summary < 0:
+		return fmt.Errorf("summary must be positive hours: %v", s.Summary)
+	case s.Summary > 0:
+		// The digest doesn't ask the character.
+		s.schedule, s.location = schedule, c.location
+		return nil
+	}
+
+	text := s.Prompt
+	if strings.TrimSpace(text) == "" {
+		text = c.InitText
+	}
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("prompt is required without initText")
+	}
+	allFragments := map[string]string{}
+	for name, text := range fragments {
+		allFragments[name] = text
+	}
+	for name, text := range c.Fragments {
+		allFragments[name] = text
+	}
+	t, err := prompt.Parse("prompt", text, allFragments)
+	if err != nil {
+		return err
+	}
+	s.schedule, s.template, s.location = schedule, t, c.location
+	return nil
+}
+
+// validateSchedules checks the schedules of the character.
+func (c *Config) validateSchedules(nodes map[string]fieldNode) Errors {
+	var errs Errors
+	fail := func(format string, args ...interface{}) {
+		e := &FieldError{Field: "schedules", Message: fmt.Sprintf(format, args...)}
+		if n, ok := nodes["schedules"]; ok {
+			e.Source, e.Line = n.source, n.node.Line
+		}
+		errs = append(errs, e)
+	}
+
+	names := map[string]bool{}
+	for i, s := range c.Schedules {
+		switch {
+		case s.Name == "":
+			fail("name of schedule #%d is required", i)
+		case names[s.Name]:
+			fail("schedule %v is duplicated", s.Name)
+		}
+		names[s.Name] = true
+		if err := c.ParseSchedule(s); err != nil {
+			fail("schedule %v: %v", s.Name, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,327 @@
+package configs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/yuanying/myao/model/prompt"
+)
+
+var (
+	yamlLineRegexp = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+)
+
+// FieldError is an error of a field in the character config.
+type FieldError struct {
+	// Source is the base character or the file the error is found in, or empty if it's the config itself.
+	Source string
+	// Line is the line number in the YAML, or 0 if unknown.
+	Line    int
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	var b strings.Builder
+	if e.Source != "" {
+		fmt.Fprintf(&b, "%s: ", e.Source)
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "line %d: ", e.Line)
+	}
+	if e.Field != "" {
+		fmt.Fprintf(&b, "%s: ", e.Field)
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// Errors are all errors found in a character config.
+type Errors []*FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// fieldNode is the YAML node of a field, and the source it's defined in.
+type fieldNode struct {
+	source string
+	node   *yaml.Node
+}
+
+// Parse decodes the character config strictly, merging it into its base, and validates it.
+// The returned error is Errors if the YAML is well-formed.
+func Parse(data []byte) (*Config, error) {
+	return parse(data, "")
+}
+
+func parse(data []byte, name string) (*Config, error) {
+	return parseConfig(data, name, true)
+}
+
+// parseConfig parses the config, loading the characters of its pipeline if stages is true.
+func parseConfig(data []byte, name string, stages bool) (*Config, error) {
+	config := &Config{}
+	nodes := map[string]fieldNode{}
+	errs, ok := config.decode(data, name, name, nodes, map[string]bool{})
+	if ok {
+		errs = append(errs, config.validate(nodes)...)
+		if stages && config.Pipeline != nil {
+			errs = append(errs, config.validatePipeline(name, nodes)...)
+		}
+	}
+	if len(errs) > 0 {
+		// Report the errors of the config itself after the ones of its bases.
+		sort.SliceStable(errs, func(i, j int) bool {
+			if (errs[i].Source == "") != (errs[j].Source == "") {
+				return errs[i].Source != ""
+			}
+			return errs[i].Line < errs[j].Line
+		})
+		return nil, errs
+	}
+	return config, nil
+}
+
+// decode decodes data named name into c after decoding its base.
+// The errors are reported as the ones of source, which is empty for the config being parsed.
+// It returns false if data can't be decoded at all.
+func (c *Config) decode(data []byte, name, root string, nodes map[string]fieldNode, seen map[string]bool) (Errors, bool) {
+	source := name
+	if name == root {
+		source = ""
+	}
+	seen[name] = true
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		e := yamlError(err.Error())
+		e.Source = source
+		return Errors{e}, false
+	}
+	fields := fieldNodes(&doc)
+
+	var errs Errors
+	if extends, ok := fields["extends"]; ok && extends.Value != "" {
+		baseName, baseData, err := resolve(extends.Value, name)
+		switch {
+		case err != nil:
+			return Errors{{Source: source, Line: extends.Line, Field: "extends", Message: err.Error()}}, false
+		case seen[baseName]:
+			return Errors{{Source: source, Line: extends.Line, Field: "extends", Message: fmt.Sprintf("circular inheritance: %v", baseName)}}, false
+		}
+		baseErrs, ok := c.decode(baseData, baseName, root, nodes, seen)
+		if !ok {
+			return baseErrs, false
+		}
+		errs = append(errs, baseErrs...)
+	}
+
+	c.reset(fields)
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil {
+		// The other fields are still decoded on type errors, so go on validating them.
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			e := yamlError(err.Error())
+			e.Source = source
+			return append(errs, e), false
+		}
+		for _, msg := range typeErr.Errors {
+			e := yamlError(msg)
+			e.Source = source
+			errs = append(errs, e)
+		}
+	}
+	for field, node := range fields {
+		nodes[field] = fieldNode{source: source, node: node}
+	}
+	return errs, true
+}
+
+// reset clears the fields written in the config, so that they replace the values of the base as a whole
+// instead of being merged into them. The fragments are merged by name for the templates of the base.
+func (c *Config) reset(fields map[string]*yaml.Node) {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+		if _, ok := fields[name]; ok && name != "" && name != "fragments" {
+			v.Field(i).Set(reflect.Zero(v.Field(i).Type()))
+		}
+	}
+}
+
+// resolve returns the name and the data of the base character ref extended by the character named from.
+func resolve(ref, from string) (string, []byte, error) {
+	if ext := filepath.Ext(ref); ext == ".yaml" || ext == ".yml" {
+		path := ref
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(from), ref)
+		}
+		data, err := os.ReadFile(path)
+		return path, data, err
+	}
+	data, ok := builtin[ref]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown character: %v", ref)
+	}
+	return ref, data, nil
+}
+
+func yamlError(msg string) *FieldError {
+	if m := yamlLineRegexp.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return &FieldError{Line: line, Message: m[2]}
+	}
+	return &FieldError{Message: strings.TrimPrefix(msg, "yaml: ")}
+}
+
+// fieldNodes returns the value nodes of the top-level fields.
+func fieldNodes(doc *yaml.Node) map[string]*yaml.Node {
+	nodes := map[string]*yaml.Node{}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nodes
+	}
+	mapping := doc.Content[0]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		nodes[mapping.Content[i].Value] = mapping.Content[i+1]
+	}
+	return nodes
+}
+
+// validate checks the fields, and parses the timezone and the templates.
+func (c *Config) validate(nodes map[string]fieldNode) Errors {
+	var errs Errors
+	fail := func(field, format string, args ...interface{}) {
+		e := &FieldError{Field: field, Message: fmt.Sprintf(format, args...)}
+		if n, ok := nodes[field]; ok {
+			e.Source, e.Line = n.source, n.node.Line
+		}
+		errs = append(errs, e)
+	}
+
+	for _, f := range []struct{ name, value string }{
+		{"name", c.Name},
+		{"systemText", c.SystemText},
+		{"errorText", c.ErrorText},
+		{"textFormat", c.TextFormat},
+	} {
+		if strings.TrimSpace(f.value) == "" {
+			fail(f.name, "is required")
+		}
+	}
+	if c.Temperature < 0 || c.Temperature > 2 {
+		fail("temperature", "must be between 0 and 2: %v", c.Temperature)
+	}
+	if c.TopP < 0 || c.TopP > 1 {
+		fail("topP", "must be between 0 and 1: %v", c.TopP)
+	}
+	if c.PresencePenalty < -2 || c.PresencePenalty > 2 {
+		fail("presencePenalty", "must be between -2 and 2: %v", c.PresencePenalty)
+	}
+	if c.FrequencyPenalty < -2 || c.FrequencyPenalty > 2 {
+		fail("frequencyPenalty", "must be between -2 and 2: %v", c.FrequencyPenalty)
+	}
+	if c.MaxTokens < 0 {
+		fail("maxTokens", "must not be negative: %v", c.MaxTokens)
+	}
+	if c.Timeout < 0 {
+		fail("timeout", "must not be negative: %v", c.Timeout)
+	}
+	switch c.ResponseFormat {
+	case "", "text", "json_object":
+	default:
+		fail("responseFormat", "must be either text or json_object: %q", c.ResponseFormat)
+	}
+	for i, m := range c.InitConversations {
+		switch m.Role {
+		case "system", "user", "assistant":
+		default:
+			fail("initConversations", "role of #%d must be system, user or assistant: %q", i, m.Role)
+		}
+	}
+
+	c.location = time.Local
+	if c.Timezone != "" {
+		location, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			fail("timezone", "%v", err)
+		} else {
+			c.location = location
+		}
+	}
+
+	allFragments := map[string]string{}
+	for name, text := range fragments {
+		allFragments[name] = text
+	}
+	for name, text := range c.Fragments {
+		allFragments[name] = text
+	}
+	for name, text := range c.Fragments {
+		if _, err := prompt.Parse(name, text, allFragments); err != nil {
+			fail("fragments", "%v: %v", name, err)
+		}
+	}
+
+	c.templates = map[string]*template.Template{}
+	for _, f := range []struct{ name, text string }{
+		{"systemText", c.SystemText},
+		{"initText", c.InitText},
+		{"summaryText", c.SummaryText},
+		{"textFormat", c.TextFormat},
+	} {
+		t, err := prompt.Parse(f.name, f.text, allFragments)
+		if err != nil {
+			errs = append(errs, templateError(f.name, nodes, err))
+			continue
+		}
+		c.templates[f.name] = t
+	}
+	errs = append(errs, c.validateSchedules(nodes)...)
+	if t, ok := c.templates["textFormat"]; ok && c.TextFormat != "" {
+		const content = "\x00content\x00"
+		if !strings.Contains(prompt.Render(t, &prompt.Vars{Content: content}), content) {
+			fail("textFormat", "must contain {{.Content}}")
+		}
+	}
+	return errs
+}
+
+// templateError returns the error of the template with the line number in the YAML.
+func templateError(field string, nodes map[string]fieldNode, err error) *FieldError {
+	e := &FieldError{Field: field, Message: err.Error()}
+	n, ok := nodes[field]
+	if !ok {
+		return e
+	}
+	node := n.node
+	e.Source, e.Line = n.source, node.Line
+	// Errors in the template itself, not in the fragments, are prefixed by "template: <field>:<line>:".
+	rest, ok := strings.CutPrefix(err.Error(), "template: "+field+":")
+	if !ok || node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+		return e
+	}
+	if line, err := strconv.Atoi(strings.SplitN(rest, ":", 2)[0]); err == nil {
+		// The content of block scalars starts at the next line of the indicator.
+		e.Line += line
+	}
+	return e
+}
@@ -0,0 +1,128 @@
+package configs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yuanying/myao/model/prompt"
+)
+
+func TestInheritance(t *testing.T) {
+	base := `
+name: Base
+temperature: 0.5
+errorText: error
+textFormat: "{{.Content}}"
+fragments:
+  tone: base tone
+  rule: base rule
+systemText: '{{template "tone" .}} / {{template "rule" .}}'
+pipeline:
+  stages:
+  - name: first
+  - name: second
+  output: "{{.Outputs.first}}"
+`
+	tests := []struct {
+		name  string
+		files map[string]string
+		check func(t *testing.T, c *Config)
+		// wantErr is the part of the error, or empty if the config is valid.
+		wantErr string
+	}{
+		{
+			name:  "inherited",
+			files: map[string]string{"child.yaml": "extends: base.yaml\ntemperature: 1\n"},
+			check: func(t *testing.T, c *Config) {
+				if c.Name != "Base" || c.Temperature != 1 {
+					t.Errorf("name, temperature = %q, %v, want Base, 1", c.Name, c.Temperature)
+				}
+				if c.Pipeline == nil || len(c.Pipeline.Stages) != 2 || c.Pipeline.Output != "{{.Outputs.first}}" {
+					t.Errorf("pipeline = %+v, want the pipeline of the base", c.Pipeline)
+				}
+			},
+		},
+		{
+			name:  "pipeline replaced",
+			files: map[string]string{"child.yaml": "extends: base.yaml\npipeline:\n  stages:\n  - name: only\n"},
+			check: func(t *testing.T, c *Config) {
+				if len(c.Pipeline.Stages) != 1 || c.Pipeline.Output != "" {
+					t.Errorf("pipeline = %+v, want only the stage of the child", c.Pipeline)
+				}
+				vars := &prompt.StageVars{Outputs: map[string]string{"only": "reply"}}
+				if output := c.Pipeline.RenderOutput(vars); output != "reply" {
+					t.Errorf("output = %q, want reply", output)
+				}
+			},
+		},
+		{
+			name:  "pipeline removed",
+			files: map[string]string{"child.yaml": "extends: base.yaml\npipeline: null\n"},
+			check: func(t *testing.T, c *Config) {
+				if c.Pipeline != nil {
+					t.Errorf("pipeline = %+v, want nil", c.Pipeline)
+				}
+			},
+		},
+		{
+			name:  "fragments merged",
+			files: map[string]string{"child.yaml": "extends: base.yaml\nfragments:\n  tone: child tone\n"},
+			check: func(t *testing.T, c *Config) {
+				if text := c.RenderSystemText(&prompt.Vars{}); text != "child tone / base rule" {
+					t.Errorf("systemText = %q, want child tone / base rule", text)
+				}
+			},
+		},
+		{
+			name:  "shared fragments",
+			files: map[string]string{"child.yaml": "extends: base.yaml\nsystemText: '{{template \"myao-tone\" .}}'\n"},
+			check: func(t *testing.T, c *Config) {
+				if text := c.RenderSystemText(&prompt.Vars{}); text != fragments["myao-tone"] {
+					t.Errorf("systemText = %q, want the shared fragment", text)
+				}
+			},
+		},
+		{
+			name:    "unknown fragment",
+			files:   map[string]string{"child.yaml": "extends: base.yaml\nsystemText: '{{template \"unknown\" .}}'\n"},
+			wantErr: "systemText",
+		},
+		{
+			name:    "circular",
+			files:   map[string]string{"child.yaml": "extends: other.yaml\n", "other.yaml": "extends: child.yaml\n"},
+			wantErr: "circular inheritance",
+		},
+		{
+			name:    "unknown base",
+			files:   map[string]string{"child.yaml": "extends: unknown\n"},
+			wantErr: "unknown character",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := map[string]string{"base.yaml": base}
+			for name, data := range tt.files {
+				files[name] = data
+			}
+			for name, data := range files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c, err := LoadFile(filepath.Join(dir, "child.yaml"))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadFile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, c)
+		})
+	}
+}
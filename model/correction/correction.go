@@ -0,0 +1,169 @@
+package correction
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Correction is the grammar correction of a message, returned by the characters as JSON.
+type Correction struct {
+	// Reply is the answer to the message, given by the characters replying and correcting at once.
+	Reply     string  `json:"reply,omitempty"`
+	Original  string  `json:"original"`
+	Corrected string  `json:"corrected"`
+	Errors    []Error `json:"errors"`
+}
+
+// Error is a grammatical error found in the original message.
+type Error struct {
+	// Category is the kind of the error, e.g. tense, articles or prepositions.
+	Category string `json:"category"`
+	// Span is the part of the original message having the error.
+	Span        string `json:"span"`
+	Explanation string `json:"explanation"`
+}
+
+// Parse parses the JSON correction. The code fence around the JSON is ignored.
+func Parse(text string) (*Correction, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```json")
+		text = strings.TrimPrefix(text, "```")
+		text = strings.TrimSuffix(text, "```")
+	}
+	c := &Correction{}
+	if err := json.Unmarshal([]byte(text), c); err != nil {
+		return nil, fmt.Errorf("invalid correction: %w", err)
+	}
+	for i := range c.Errors {
+		c.Errors[i].Category = strings.ToLower(strings.TrimSpace(c.Errors[i].Category))
+		if c.Errors[i].Category == "" {
+			c.Errors[i].Category = "other"
+		}
+	}
+	return c, nil
+}
+
+// HasErrors returns true if the message has any error to correct.
+func (c *Correction) HasErrors() bool {
+	return c != nil && len(c.Errors) > 0 && c.Original != c.Corrected
+}
+
+// Diff returns the corrected message in Slack mrkdwn, striking the removed words and making the added words bold.
+func (c *Correction) Diff() string {
+	var b strings.Builder
+	for _, op := range diff(strings.Fields(c.Original), strings.Fields(c.Corrected)) {
+		if b.Len() > 0 {
+			b.WriteString(" ")
+		}
+		switch op.kind {
+		case deleted:
+			fmt.Fprintf(&b, "~%s~", strings.Join(op.words, " "))
+		case inserted:
+			fmt.Fprintf(&b, "*%s*", strings.Join(op.words, " "))
+		default:
+			b.WriteString(strings.Join(op.words, " "))
+		}
+	}
+	return b.String()
+}
+
+// Text returns the correction in Slack mrkdwn, or empty if there is no error.
+func (c *Correction) Text() string {
+	if !c.HasErrors() {
+		return ""
+	}
+	lines := []string{"*Correction*", c.Diff()}
+	for _, e := range c.Errors {
+		lines = append(lines, e.Text())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Text returns the error in Slack mrkdwn.
+func (e *Error) Text() string {
+	if e.Span == "" {
+		return fmt.Sprintf("• *%s*: %s", e.Category, e.Explanation)
+	}
+	return fmt.Sprintf("• *%s* `%s`: %s", e.Category, e.Span, e.Explanation)
+}
+
+type opKind int
+
+const (
+	equal opKind = iota
+	deleted
+	inserted
+)
+
+type op struct {
+	kind  opKind
+	words []string
+}
+
+// diff returns the word-level edit operations from a to b by their longest common subsequence.
+func diff(a, b []string) []op {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []op
+	add := func(kind opKind, word string) {
+		if n := len(ops); n > 0 && ops[n-1].kind == kind {
+			ops[n-1].words = append(ops[n-1].words, word)
+			return
+		}
+		ops = append(ops, op{kind: kind, words: []string{word}})
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			add(equal, a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add(deleted, a[i])
+			i++
+		default:
+			add(inserted, b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		add(deleted, a[i])
+	}
+	for ; j < len(b); j++ {
+		add(inserted, b[j])
+	}
+	return ops
+}
+
+// Cloze returns the corrected message blanking the words added by the correction, and the blanked words.
+// answers is empty if the correction only removes words.
+func (c *Correction) Cloze() (text string, answers []string) {
+	var words []string
+	for _, op := range diff(strings.Fields(c.Original), strings.Fields(c.Corrected)) {
+		switch op.kind {
+		case inserted:
+			words = append(words, "____")
+			answers = append(answers, strings.Join(op.words, " "))
+		case equal:
+			words = append(words, op.words...)
+		}
+	}
+	return strings.Join(words, " "), answers
+}
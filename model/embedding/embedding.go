@@ -0,0 +1,178 @@
+package embedding
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/yuanying/myao/model/budget"
+)
+
+const (
+	BackendNone   = ""
+	BackendOpenAI = "openai"
+	BackendLocal  = "local"
+
+	// maxBatch is the number of the texts embedded by a request.
+	maxBatch = 100
+)
+
+// Embedder converts texts into vectors close to each other if the texts are similar.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Model is the name of the model, whose vectors can't be compared with the other models'.
+	Model() string
+}
+
+type Opts struct {
+	// Backend selects the embeddings implementation.
+	// "openai" uses the OpenAI embeddings API and "local" uses an OpenAI-compatible server at BaseURL.
+	Backend              string
+	BaseURL              string
+	Model                string
+	AccessToken          string
+	OpenAIOrganizationID string
+	Budget               *budget.Budget
+}
+
+// New returns the Embedder for opts.Backend, or nil if embeddings are disabled.
+func New(opts *Opts) (Embedder, error) {
+	switch opts.Backend {
+	case BackendNone:
+		return nil, nil
+	case BackendOpenAI:
+		config := openai.DefaultConfig(opts.AccessToken)
+		if opts.OpenAIOrganizationID != "" {
+			config.OrgID = opts.OpenAIOrganizationID
+		}
+		if opts.BaseURL != "" {
+			config.BaseURL = opts.BaseURL
+		}
+		return newOpenAI(config, opts), nil
+	case BackendLocal:
+		if opts.BaseURL == "" {
+			return nil, fmt.Errorf("embedding backend %q requires a base URL", opts.Backend)
+		}
+		config := openai.DefaultConfig(opts.AccessToken)
+		config.BaseURL = opts.BaseURL
+		return newOpenAI(config, opts), nil
+	default:
+		return nil, fmt.Errorf("unknown embedding backend: %v", opts.Backend)
+	}
+}
+
+// Vector is the embedding of a text, marshaled in base64 of the little-endian float32s to keep the files small.
+type Vector []float32
+
+func (v Vector) MarshalJSON() ([]byte, error) {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(buf))
+}
+
+func (v *Vector) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	buf, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	if len(buf)%4 != 0 {
+		return fmt.Errorf("vector has %d bytes", len(buf))
+	}
+	*v = make(Vector, len(buf)/4)
+	for i := range *v {
+		(*v)[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return nil
+}
+
+// Similarity returns the cosine similarity of the vectors, or 0 if their dimensions differ.
+func Similarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+type openAIEmbedder struct {
+	client *openai.Client
+	model  string
+	budget *budget.Budget
+}
+
+func newOpenAI(config openai.ClientConfig, opts *Opts) *openAIEmbedder {
+	model := opts.Model
+	if model == "" {
+		model = string(openai.SmallEmbedding3)
+	}
+	return &openAIEmbedder{
+		client: openai.NewClientWithConfig(config),
+		model:  model,
+		budget: opts.Budget,
+	}
+}
+
+func (e *openAIEmbedder) Model() string {
+	return e.model
+}
+
+func (e *openAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += maxBatch {
+		end := start + maxBatch
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch, err := e.embed(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+func (e *openAIEmbedder) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if e.budget.Exceeded(time.Now()) {
+		return nil, budget.ErrExceeded
+	}
+	res, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Input: texts,
+		Model: openai.EmbeddingModel(e.model),
+	})
+	if err != nil {
+		return nil, err
+	}
+	e.budget.Record(e.model, res.Usage, time.Now())
+	if len(res.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings of %d texts are returned for %d texts", len(res.Data), len(texts))
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range res.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding index is out of range: %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
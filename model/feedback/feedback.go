@@ -0,0 +1,97 @@
+package feedback
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const feedbackFile = "feedback.jsonl"
+
+const (
+	Positive = "positive"
+	Negative = "negative"
+	Retry    = "retry"
+)
+
+type Opts struct {
+	PersistentDir string
+	// Positive, Negative and Retry are the names of the reactions giving the feedback, e.g. "+1".
+	Positive []string
+	Negative []string
+	Retry    []string
+}
+
+// Entry is a feedback on a reply, recorded with the prompt for later evaluation.
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	Reaction string    `json:"reaction"`
+	// User is the user giving the feedback.
+	User      string `json:"user"`
+	Character string `json:"character"`
+	Channel   string `json:"channel"`
+	// Message is the timestamp of the reply.
+	Message string `json:"message"`
+	// Speaker is the user the character replied to.
+	Speaker string `json:"speaker"`
+	Prompt  string `json:"prompt"`
+	Reply   string `json:"reply"`
+}
+
+// Recorder appends the feedbacks to feedback.jsonl in the persistent dir.
+type Recorder struct {
+	dir   string
+	kinds map[string]string
+
+	// mu serializes the writes to the file.
+	mu sync.Mutex
+}
+
+func New(opts *Opts) *Recorder {
+	r := &Recorder{dir: opts.PersistentDir, kinds: map[string]string{}}
+	for kind, reactions := range map[string][]string{Positive: opts.Positive, Negative: opts.Negative, Retry: opts.Retry} {
+		for _, reaction := range reactions {
+			r.kinds[strings.Trim(reaction, ":")] = kind
+		}
+	}
+	return r
+}
+
+// Kind returns the kind of the feedback given by the reaction, or empty if the reaction isn't a feedback.
+// The skin tones of the reactions are ignored.
+func (r *Recorder) Kind(reaction string) string {
+	if r == nil {
+		return ""
+	}
+	name, _, _ := strings.Cut(reaction, "::")
+	return r.kinds[name]
+}
+
+// Record appends the entry.
+func (r *Recorder) Record(e *Entry) {
+	if r == nil {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		klog.Errorf("Failed to marshal feedback: %v", err)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, err := os.OpenFile(filepath.Join(r.dir, feedbackFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		klog.Errorf("Failed to open feedback: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		klog.Errorf("Failed to write feedback: %v", err)
+	}
+}
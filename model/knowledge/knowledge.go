@@ -0,0 +1,273 @@
+package knowledge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/yuanying/myao/model"
+	"github.com/yuanying/myao/model/embedding"
+)
+
+const (
+	indexFile = "knowledge.json"
+	// minSimilarity is the similarity under which the chunks aren't retrieved.
+	minSimilarity = 0.3
+)
+
+var _ model.Knowledge = (*Base)(nil)
+
+type Opts struct {
+	// Dir is the directory of the Markdown, text and HTML documents.
+	Dir           string
+	PersistentDir string
+	Embedder      embedding.Embedder
+	// TopK is the max number of the chunks retrieved into the prompt.
+	TopK int
+	// Interval is the interval to check the changes of the documents.
+	Interval time.Duration
+}
+
+// Base is the knowledge base of the documents in a directory.
+// The documents are chunked by the headings and embedded, and the index is kept in knowledge.json
+// in the persistent dir so that only the documents changed are embedded again.
+type Base struct {
+	opts *Opts
+	file string
+
+	// mu protects index from concurrent access.
+	mu    sync.Mutex
+	index index
+}
+
+type index struct {
+	// Model is the embedding model of the vectors.
+	Model string `json:"model"`
+	// Files are the documents by the path relative to the directory.
+	Files map[string]*document `json:"files"`
+}
+
+type document struct {
+	ModTime time.Time `json:"modTime"`
+	Size    int64     `json:"size"`
+	Chunks  []*chunk  `json:"chunks"`
+}
+
+type chunk struct {
+	// Heading is the path of the headings of the section, e.g. "Deploy > Rollback".
+	Heading string           `json:"heading"`
+	Text    string           `json:"text"`
+	Vector  embedding.Vector `json:"vector"`
+}
+
+func New(opts *Opts) (*Base, error) {
+	info, err := os.Stat(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("knowledge base isn't a directory: %v", opts.Dir)
+	}
+	b := &Base{
+		opts:  opts,
+		file:  filepath.Join(opts.PersistentDir, indexFile),
+		index: index{Files: map[string]*document{}},
+	}
+	b.load()
+	return b, nil
+}
+
+// Run indexes the documents changed until ctx is done.
+func (b *Base) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if err := b.refresh(ctx); err != nil && ctx.Err() == nil {
+			klog.Errorf("Failed to index knowledge base: %v, %v", b.opts.Dir, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Search returns the chunks most similar to content.
+func (b *Base) Search(ctx context.Context, content string) []model.Document {
+	b.mu.Lock()
+	ready := b.index.Model == b.opts.Embedder.Model() && len(b.index.Files) > 0
+	b.mu.Unlock()
+	if b.opts.TopK <= 0 || !ready {
+		return nil
+	}
+	vectors, err := b.opts.Embedder.Embed(ctx, []string{content})
+	if err != nil {
+		klog.Warningf("Failed to embed message to search: %v", err)
+		return nil
+	}
+
+	type scored struct {
+		path  string
+		chunk *chunk
+		score float64
+	}
+	var candidates []scored
+	b.mu.Lock()
+	for path, d := range b.index.Files {
+		for _, c := range d.Chunks {
+			if score := embedding.Similarity(vectors[0], c.Vector); score >= minSimilarity {
+				candidates = append(candidates, scored{path: path, chunk: c, score: score})
+			}
+		}
+	}
+	b.mu.Unlock()
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	if len(candidates) > b.opts.TopK {
+		candidates = candidates[:b.opts.TopK]
+	}
+
+	documents := make([]model.Document, len(candidates))
+	for i, c := range candidates {
+		source := c.path
+		if c.chunk.Heading != "" {
+			source += " > " + c.chunk.Heading
+		}
+		documents[i] = model.Document{Source: source, Text: c.chunk.Text}
+	}
+	klog.Infof("Retrieve %v chunks from %v", len(documents), b.opts.Dir)
+	return documents
+}
+
+// refresh indexes the documents added or changed, and removes the ones deleted.
+func (b *Base) refresh(ctx context.Context) error {
+	b.mu.Lock()
+	old := b.index
+	b.mu.Unlock()
+	stale := old.Model != b.opts.Embedder.Model()
+
+	next := index{Model: b.opts.Embedder.Model(), Files: map[string]*document{}}
+	changed := stale
+	err := filepath.WalkDir(b.opts.Dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(e.Name(), ".") && path != b.opts.Dir {
+			if e.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if e.IsDir() || !supported(path) {
+			return nil
+		}
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(b.opts.Dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d, ok := old.Files[rel]; ok && !stale && d.ModTime.Equal(info.ModTime()) && d.Size == info.Size() {
+			next.Files[rel] = d
+			return nil
+		}
+
+		chunks, err := b.chunks(ctx, path)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			// The document is indexed again next time.
+			klog.Errorf("Failed to index document: %v, %v", rel, err)
+			if d, ok := old.Files[rel]; ok && !stale {
+				next.Files[rel] = d
+			}
+			return nil
+		}
+		klog.Infof("Index %v chunks of %v", len(chunks), rel)
+		next.Files[rel] = &document{ModTime: info.ModTime(), Size: info.Size(), Chunks: chunks}
+		changed = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for rel := range old.Files {
+		if _, ok := next.Files[rel]; !ok {
+			klog.Infof("Remove %v from index", rel)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.index = next
+	b.save()
+	return nil
+}
+
+// chunks splits the document into the chunks, and embeds them.
+func (b *Base) chunks(ctx context.Context, path string) ([]*chunk, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	chunks := split(path, string(data))
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		texts[i] = c.Heading + "\n\n" + c.Text
+	}
+	vectors, err := b.opts.Embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range chunks {
+		c.Vector = vectors[i]
+	}
+	return chunks, nil
+}
+
+// save writes the index. mu must be held.
+func (b *Base) save() {
+	data, err := json.Marshal(&b.index)
+	if err != nil {
+		klog.Errorf("Failed to marshal knowledge index: %v", err)
+		return
+	}
+	if err := os.WriteFile(b.file, data, 0644); err != nil {
+		klog.Errorf("Failed to write knowledge index: %v", err)
+	}
+}
+
+func (b *Base) load() {
+	data, err := os.ReadFile(b.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.Errorf("Failed to read knowledge index: %v", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &b.index); err != nil {
+		klog.Errorf("Failed to parse knowledge index: %v", err)
+	}
+	if b.index.Files == nil {
+		b.index.Files = map[string]*document{}
+	}
+}
@@ -0,0 +1,157 @@
+package knowledge
+
+import (
+	"html"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxChunk is the max number of the runes of a chunk, which is split by the paragraphs.
+const maxChunk = 1500
+
+var (
+	headingRegexp     = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+	htmlDropRegexp    = regexp.MustCompile(`(?is)<(script|style|head)\b.*?</(script|style|head)>|<!--.*?-->`)
+	htmlHeadingRegexp = regexp.MustCompile(`(?is)<h([1-6])\b[^>]*>(.*?)</h[1-6]>`)
+	htmlBreakRegexp   = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|tr|pre|blockquote|section|article|table|ul|ol)>`)
+	htmlTagRegexp     = regexp.MustCompile(`<[^>]*>`)
+	blankLinesRegexp  = regexp.MustCompile(`\n{3,}`)
+)
+
+// supported reports whether the file is a document of the knowledge base.
+func supported(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown", ".txt", ".html", ".htm":
+		return true
+	}
+	return false
+}
+
+// split splits the document into the chunks of the sections.
+// HTML is converted into Markdown headings and plain text, and text files are a section without headings.
+func split(path, text string) []*chunk {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		text = htmlText(text)
+	case ".txt":
+		return paragraphs("", text)
+	}
+
+	var (
+		chunks   []*chunk
+		headings []string
+		section  []string
+		fence    bool
+	)
+	flush := func() {
+		var path []string
+		for _, h := range headings {
+			if h != "" {
+				path = append(path, h)
+			}
+		}
+		chunks = append(chunks, paragraphs(strings.Join(path, " > "), strings.Join(section, "\n"))...)
+		section = nil
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fence = !fence
+		}
+		m := headingRegexp.FindStringSubmatch(line)
+		if fence || m == nil {
+			section = append(section, line)
+			continue
+		}
+		flush()
+		level := len(m[1])
+		for len(headings) >= level {
+			headings = headings[:len(headings)-1]
+		}
+		for len(headings) < level-1 {
+			// The levels skipped have no headings.
+			headings = append(headings, "")
+		}
+		headings = append(headings, m[2])
+	}
+	flush()
+	return chunks
+}
+
+// paragraphs packs the paragraphs of the section into the chunks within maxChunk.
+// A paragraph longer than it is cut by the runes.
+func paragraphs(heading, text string) []*chunk {
+	var (
+		chunks []*chunk
+		parts  []string
+		size   int
+	)
+	flush := func() {
+		if len(parts) > 0 {
+			chunks = append(chunks, &chunk{Heading: heading, Text: strings.Join(parts, "\n\n")})
+			parts, size = nil, 0
+		}
+	}
+	for _, p := range blocks(text) {
+		runes := []rune(p)
+		for len(runes) > maxChunk {
+			flush()
+			chunks = append(chunks, &chunk{Heading: heading, Text: string(runes[:maxChunk])})
+			runes = runes[maxChunk:]
+		}
+		if size+len(runes) > maxChunk {
+			flush()
+		}
+		parts = append(parts, string(runes))
+		size += len(runes) + 2
+	}
+	flush()
+	return chunks
+}
+
+// blocks splits the text at the blank lines out of the code blocks.
+func blocks(text string) []string {
+	var (
+		blocks []string
+		lines  []string
+		fence  bool
+	)
+	flush := func() {
+		if b := strings.TrimSpace(strings.Join(lines, "\n")); b != "" {
+			blocks = append(blocks, b)
+		}
+		lines = nil
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fence = !fence
+		}
+		if !fence && strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		lines = append(lines, line)
+	}
+	flush()
+	return blocks
+}
+
+// htmlText converts the HTML into the text with the Markdown headings.
+func htmlText(text string) string {
+	text = htmlDropRegexp.ReplaceAllString(text, "")
+	text = htmlHeadingRegexp.ReplaceAllStringFunc(text, func(s string) string {
+		m := htmlHeadingRegexp.FindStringSubmatch(s)
+		title := strings.Join(strings.Fields(html.UnescapeString(htmlTagRegexp.ReplaceAllString(m[2], ""))), " ")
+		level, _ := strconv.Atoi(m[1])
+		return "\n\n" + strings.Repeat("#", level) + " " + title + "\n\n"
+	})
+	text = htmlBreakRegexp.ReplaceAllString(text, "\n\n")
+	text = html.UnescapeString(htmlTagRegexp.ReplaceAllString(text, ""))
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return blankLinesRegexp.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+}
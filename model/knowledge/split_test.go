@@ -0,0 +1,84 @@
+package knowledge
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		text string
+		want []chunk
+	}{
+		{
+			name: "headings",
+			path: "guide.md",
+			text: "intro\n\n# Deploy\n\nfirst\n\n## Rollback\n\nsecond\n\n#### Deep\n\nthird\n\n# FAQ\n\nfourth",
+			want: []chunk{
+				{Text: "intro"},
+				{Heading: "Deploy", Text: "first"},
+				{Heading: "Deploy > Rollback", Text: "second"},
+				{Heading: "Deploy > Rollback > Deep", Text: "third"},
+				{Heading: "FAQ", Text: "fourth"},
+			},
+		},
+		{
+			name: "code block",
+			path: "guide.md",
+			text: "# Setup\n\n```sh\n# not a heading\n\necho ok\n```\n\nafter",
+			want: []chunk{
+				{Heading: "Setup", Text: "```sh\n# not a heading\n\necho ok\n```\n\nafter"},
+			},
+		},
+		{
+			name: "code block with blank lines",
+			path: "guide.md",
+			text: strings.Repeat("a", 1000) + "\n\n```\n" + strings.Repeat("x", 300) + "\n\n" + strings.Repeat("y", 300) + "\n```",
+			want: []chunk{
+				{Text: strings.Repeat("a", 1000)},
+				{Text: "```\n" + strings.Repeat("x", 300) + "\n\n" + strings.Repeat("y", 300) + "\n```"},
+			},
+		},
+		{
+			name: "text",
+			path: "notes.txt",
+			text: "# not a heading\r\n\r\nsecond\n\n\n\nthird",
+			want: []chunk{
+				{Text: "# not a heading\n\nsecond\n\nthird"},
+			},
+		},
+		{
+			name: "html",
+			path: "page.html",
+			text: "<html><head><title>x</title></head><body><h1>Title &amp; more</h1><p>one</p><script>var x;</script><p>two</p></body></html>",
+			want: []chunk{
+				{Heading: "Title & more", Text: "one\n\ntwo"},
+			},
+		},
+		{
+			name: "long paragraphs",
+			path: "long.md",
+			text: strings.Repeat("a", 1000) + "\n\n" + strings.Repeat("b", 1000) + "\n\n" + strings.Repeat("c", 2000),
+			want: []chunk{
+				{Text: strings.Repeat("a", 1000)},
+				{Text: strings.Repeat("b", 1000)},
+				{Text: strings.Repeat("c", maxChunk)},
+				{Text: strings.Repeat("c", 2000-maxChunk)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []chunk
+			for _, c := range split(tt.path, tt.text) {
+				got = append(got, *c)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("split() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"k8s.io/klog/v2"
+
+	"github.com/yuanying/myao/model"
+	"github.com/yuanying/myao/model/configs"
+	"github.com/yuanying/myao/model/embedding"
+)
+
+const (
+	memorizerCharacter = "memorizer"
+	indexFile          = "memories.json"
+	// maxMemories bounds the index by forgetting the oldest memories.
+	maxMemories = 2000
+	// duplicateSimilarity is the similarity over which a new fact supersedes the old one, e.g. a changed preference.
+	duplicateSimilarity = 0.9
+	// minSimilarity is the similarity under which the memories aren't recalled.
+	minSimilarity = 0.3
+)
+
+var _ model.LongTermMemory = (*Memory)(nil)
+
+type Opts struct {
+	Embedder embedding.Embedder
+	// Recall is the max number of the memories recalled into the prompt.
+	Recall int
+}
+
+// Memory is the long-term memory of a character, kept in memories.json in the persistent dir.
+// The facts are picked up from the conversations by the memorizer character,
+// and recalled by the similarity of their embeddings to the message.
+type Memory struct {
+	model    *model.Shared
+	embedder embedding.Embedder
+	recall   int
+	file     string
+
+	// mu protects index from concurrent access.
+	mu    sync.Mutex
+	index index
+}
+
+type index struct {
+	// Model is the embedding model of the vectors.
+	Model    string   `json:"model"`
+	Memories []*entry `json:"memories"`
+}
+
+type entry struct {
+	Text   string           `json:"text"`
+	Time   time.Time        `json:"time"`
+	Vector embedding.Vector `json:"vector"`
+}
+
+func New(opts *model.Opts, memoryOpts *Opts) (*Memory, error) {
+	config, err := configs.Load(memorizerCharacter)
+	if err != nil {
+		return nil, err
+	}
+	opts.Overrides.Apply(config)
+	m := &Memory{
+		model: &model.Shared{
+			Config: config,
+			OpenAI: model.NewOpenAIClient(opts),
+			Opts:   opts,
+		},
+		embedder: memoryOpts.Embedder,
+		recall:   memoryOpts.Recall,
+		file:     filepath.Join(opts.PersistentDir, indexFile),
+	}
+	m.load()
+	return m, nil
+}
+
+// Recall returns the memories most similar to content with their dates.
+func (m *Memory) Recall(ctx context.Context, content string) []string {
+	if m.recall <= 0 || m.empty() {
+		return nil
+	}
+	if err := m.reindex(ctx); err != nil {
+		klog.Warningf("Failed to reindex memories: %v", err)
+		return nil
+	}
+	vectors, err := m.embedder.Embed(ctx, []string{content})
+	if err != nil {
+		klog.Warningf("Failed to embed message to recall: %v", err)
+		return nil
+	}
+
+	type scored struct {
+		entry *entry
+		score float64
+	}
+	m.mu.Lock()
+	var candidates []scored
+	for _, e := range m.index.Memories {
+		if score := embedding.Similarity(vectors[0], e.Vector); score >= minSimilarity {
+			candidates = append(candidates, scored{entry: e, score: score})
+		}
+	}
+	m.mu.Unlock()
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	if len(candidates) > m.recall {
+		candidates = candidates[:m.recall]
+	}
+
+	facts := make([]string, len(candidates))
+	for i, c := range candidates {
+		facts[i] = fmt.Sprintf("%s (%s)", c.entry.Text, c.entry.Time.In(m.model.Location()).Format("2006-01-02"))
+	}
+	klog.Infof("Recall %v memories", len(facts))
+	return facts
+}
+
+// Memorize picks up the facts of the conversation, which supersede the similar memories.
+func (m *Memory) Memorize(ctx context.Context, conversation []openai.ChatCompletionMessage) {
+	var lines []string
+	for _, msg := range conversation {
+		text := strings.TrimSpace(msg.Content)
+		for _, part := range msg.MultiContent {
+			if part.Type == openai.ChatMessagePartTypeText {
+				text = strings.TrimSpace(part.Text)
+			}
+		}
+		if text != "" && msg.Role != "system" {
+			lines = append(lines, fmt.Sprintf("%s: %s", msg.Role, text))
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	facts, err := m.extract(ctx, strings.Join(lines, "\n"))
+	if err != nil {
+		klog.Errorf("Failed to pick up memories: %v", err)
+		return
+	}
+	if len(facts) == 0 {
+		return
+	}
+	if err := m.reindex(ctx); err != nil {
+		klog.Errorf("Failed to reindex memories: %v", err)
+		return
+	}
+	vectors, err := m.embedder.Embed(ctx, facts)
+	if err != nil {
+		klog.Errorf("Failed to embed memories: %v", err)
+		return
+	}
+
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, fact := range facts {
+		e := &entry{Text: fact, Time: now, Vector: vectors[i]}
+		if old := m.similar(e.Vector); old != nil {
+			klog.Infof("Memory is superseded: %v -> %v", old.Text, fact)
+			*old = *e
+			continue
+		}
+		m.index.Memories = append(m.index.Memories, e)
+	}
+	if n := len(m.index.Memories) - maxMemories; n > 0 {
+		sort.SliceStable(m.index.Memories, func(i, j int) bool {
+			return m.index.Memories[i].Time.Before(m.index.Memories[j].Time)
+		})
+		m.index.Memories = m.index.Memories[n:]
+	}
+	klog.Infof("Memorize %v facts, %v memories in total", len(facts), len(m.index.Memories))
+	m.save()
+}
+
+// extract asks the memorizer for the facts of the conversation.
+func (m *Memory) extract(ctx context.Context, conversation string) ([]string, error) {
+	messages := []openai.ChatCompletionMessage{
+		{Role: "system", Content: m.model.RenderSystemText(m.model.Vars(ctx))},
+		{Role: "user", Content: "# Conversation:\n" + conversation},
+	}
+	output, err := m.model.ChatCompletions(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Facts []string `json:"facts"`
+	}
+	if err := json.Unmarshal([]byte(output.Choices[0].Message.Content), &result); err != nil {
+		return nil, fmt.Errorf("invalid memories: %w", err)
+	}
+	var facts []string
+	for _, fact := range result.Facts {
+		if fact = strings.TrimSpace(fact); fact != "" {
+			facts = append(facts, fact)
+		}
+	}
+	return facts, nil
+}
+
+// similar returns the memory duplicating the vector, or nil if not found. mu must be held.
+func (m *Memory) similar(v embedding.Vector) *entry {
+	var (
+		found *entry
+		best  = duplicateSimilarity
+	)
+	for _, e := range m.index.Memories {
+		if score := embedding.Similarity(v, e.Vector); score >= best {
+			found, best = e, score
+		}
+	}
+	return found
+}
+
+func (m *Memory) empty() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.index.Memories) == 0
+}
+
+// reindex embeds the memories again if they are embedded by another model.
+func (m *Memory) reindex(ctx context.Context) error {
+	m.mu.Lock()
+	stale := m.index.Model != m.embedder.Model()
+	var texts []string
+	for _, e := range m.index.Memories {
+		texts = append(texts, e.Text)
+	}
+	m.mu.Unlock()
+	if !stale {
+		return nil
+	}
+
+	klog.Infof("Reindex %v memories by %v", len(texts), m.embedder.Model())
+	vectors, err := m.embedder.Embed(ctx, texts)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.index.Memories) != len(texts) {
+		return fmt.Errorf("memories are changed while reindexing")
+	}
+	for i, e := range m.index.Memories {
+		e.Vector = vectors[i]
+	}
+	m.index.Model = m.embedder.Model()
+	m.save()
+	return nil
+}
+
+// save writes the index. mu must be held.
+func (m *Memory) save() {
+	data, err := json.Marshal(&m.index)
+	if err != nil {
+		klog.Errorf("Failed to marshal memories: %v", err)
+		return
+	}
+	if err := os.WriteFile(m.file, data, 0644); err != nil {
+		klog.Errorf("Failed to write memories: %v", err)
+	}
+}
+
+func (m *Memory) load() {
+	data, err := os.ReadFile(m.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.Errorf("Failed to read memories: %v", err)
+		}
+		m.index.Model = m.embedder.Model()
+		return
+	}
+	if err := json.Unmarshal(data, &m.index); err != nil {
+		klog.Errorf("Failed to parse memories: %v", err)
+	}
+}
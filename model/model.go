@@ -3,23 +3,52 @@ package model
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/pkoukk/tiktoken-go"
 	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
 	"github.com/sashabaranov/go-openai"
 	"k8s.io/klog/v2"
 
+	"github.com/yuanying/myao/model/budget"
 	"github.com/yuanying/myao/model/configs"
+	"github.com/yuanying/myao/model/correction"
+	"github.com/yuanying/myao/model/prompt"
 )
 
 const (
-	model       = "gpt-4o"
-	summaryFile = "summary.txt"
+	defaultModel = "gpt-4o"
+	summaryFile  = "summary.txt"
+	// continueText asks to continue the reply truncated, e.g. by the max tokens.
+	continueText = "Continue your last reply exactly from where it stopped. Don't repeat what you have already written."
+	// recallText introduces the long-term memories recalled into the system text.
+	recallText = "# Long-term memories:\nThe facts you remember from the past conversations. Use them only if they are relevant.\n"
+	// profileText introduces the profile of the speaker into the system text.
+	profileText = "# Profile of %s:\nWhat you know about the speaker. Call the speaker by the preferred name if any.\n"
+	// knowledgeText introduces the documents retrieved into the system text.
+	knowledgeText = "# Knowledge base:\nThe excerpts of the documents related to the message. " +
+		"Answer with them if they are relevant, citing the numbers of the excerpts like [1]. Don't cite them otherwise.\n"
 )
 
+var (
+	// citationRegexp matches the citations of the documents, e.g. "[1]", but not the indexes, e.g. "arr[1]".
+	citationRegexp = regexp.MustCompile(`(?:^|[^\w\])])\[(\d+)\]`)
+	codeSpanRegexp = regexp.MustCompile("`[^`]*`")
+	// sourcesRegexp matches the list of the documents cited appended to the reply.
+	sourcesRegexp = regexp.MustCompile(`\n\nSources:(\n- \[\d+\] [^\n]*)+$`)
+)
+
+// ErrNotRemembered is returned if the reply to continue isn't in the memories.
+var ErrNotRemembered = errors.New("reply isn't remembered")
+
 func init() {
 	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
 }
@@ -28,24 +57,112 @@ type Opts struct {
 	OpenAIAccessToken    string
 	OpenAIOrganizationID string
 	CharacterType        string
-	UsersMap             map[string]string
 	PersistentDir        string
+	Budget               *budget.Budget
+
+	// RequestTimeout is the timeout of each request to OpenAI.
+	RequestTimeout time.Duration
+	// MaxRetries is the number of retries of a request failed by transient errors.
+	MaxRetries int
+	// FallbackModels are tried in order if the model keeps failing.
+	FallbackModels []string
+	// Overrides are applied to the configs of all characters.
+	Overrides *configs.Overrides
+	// LongTerm keeps the facts of the conversations beyond the resets. Disabled if nil.
+	LongTerm LongTermMemory
+	// Knowledge is the documents the character answers about. Disabled if nil.
+	Knowledge Knowledge
 }
 
 type Model interface {
-	FormatText(user, content string) string
+	FormatText(ctx context.Context, user, content string) string
 	Remember(role, content string, fileDataUrls []string)
-	Reply(content string, fileDataUrls []string) (string, error)
-	Reset() (string, error)
+	// Reply returns the response to content, which isn't nil even with errors.
+	Reply(ctx context.Context, content string, fileDataUrls []string) (*Response, error)
+	Reset(ctx context.Context) (string, error)
 	Name() string
+	LimitText() string
 	SaveSummary(summary string)
 	LoadSummary()
 }
 
+// LongTermMemory keeps the facts of the conversations beyond the resets of the memories.
+type LongTermMemory interface {
+	// Recall returns the facts related to content.
+	Recall(ctx context.Context, content string) []string
+	// Memorize keeps the facts of the conversation being forgotten.
+	Memorize(ctx context.Context, conversation []openai.ChatCompletionMessage)
+}
+
+// Knowledge searches the documents the character answers about.
+type Knowledge interface {
+	// Search returns the excerpts of the documents related to content.
+	Search(ctx context.Context, content string) []Document
+}
+
+// Document is an excerpt of a document.
+type Document struct {
+	// Source is the location of the excerpt shown in the citations, e.g. the path and the heading.
+	Source string
+	Text   string
+}
+
+// Response is the reply of the model.
+type Response struct {
+	Text string
+	// Correction is the grammar correction of the message, or nil if the model doesn't correct it.
+	Correction *correction.Correction
+	// Turns are the exchanges remembered by the reply.
+	Turns []Turn
+}
+
+// Turn is an exchange of a message and the reply in the memories.
+type Turn struct {
+	Memory  *Shared
+	Content string
+	Reply   string
+}
+
+// Continue continues the reply of the first turn, which is supposed to end the text of the response.
+// The continuation is appended to the reply in the memories.
+func (r *Response) Continue(ctx context.Context) (*Response, error) {
+	if len(r.Turns) == 0 {
+		return nil, ErrNotRemembered
+	}
+	t := r.Turns[0]
+	continuation, err := t.Memory.Continue(ctx, t.Content, t.Reply)
+	if err != nil {
+		return nil, err
+	}
+	// The continuation goes before the sources.
+	reply, footer := splitSources(t.Reply)
+	text, _ := splitSources(r.Text)
+	turns := append([]Turn{}, r.Turns...)
+	turns[0].Reply = reply + continuation + footer
+	return &Response{Text: text + continuation + footer, Correction: r.Correction, Turns: turns}, nil
+}
+
+// Forget removes the exchanges of the response from the memories, and returns true if any is removed.
+func (r *Response) Forget() bool {
+	forgot := false
+	for _, t := range r.Turns {
+		if t.Memory.Unremember(t.Content, t.Reply) {
+			forgot = true
+		}
+	}
+	return forgot
+}
+
 type Shared struct {
 	*configs.Config
 	OpenAI *openai.Client
 	Opts   *Opts
+	// SummaryFile is the file name of the summary in the persistent dir. "summary.txt" is used if empty.
+	SummaryFile string
+	// LongTerm keeps the facts of the memories reset. Disabled if nil.
+	LongTerm LongTermMemory
+	// Knowledge is searched for the documents related to the messages. Disabled if nil.
+	Knowledge Knowledge
 
 	// mu protects memories from concurrent access.
 	mu        sync.RWMutex
@@ -87,24 +204,28 @@ func (s *Shared) Remember(role, content string, fileDataUrls []string) {
 	s.messages = append(s.messages, *ChatCompletionMessage(role, content, fileDataUrls))
 }
 
-func (s *Shared) Reset() (string, error) {
+func (s *Shared) Reset(ctx context.Context) (string, error) {
 	klog.Infof("Reset the old memories")
-	messages := s.Messages()
-	messages = append(messages, openai.ChatCompletionMessage{Role: "user", Content: s.Config.SummaryText})
-
-	output, err := s.OpenAI.CreateChatCompletion(
-		context.TODO(),
-		openai.ChatCompletionRequest{
-			Model:       model,
-			Messages:    messages,
-			Temperature: s.Temperature,
-		},
-	)
+	messages := s.Messages(ctx)
+	conversation := messages[1:]
+	messages = append(messages, openai.ChatCompletionMessage{Role: "user", Content: s.RenderSummaryText(s.Vars(ctx))})
+
+	request := s.ChatCompletionRequest(messages)
+	// The summary is in text even if the character replies in JSON.
+	request.ResponseFormat = nil
+	output, err := s.createChatCompletion(ctx, request)
+	if errors.Is(err, budget.ErrExceeded) {
+		return s.LimitText(), err
+	}
+	if ctx.Err() != nil {
+		klog.Infof("Reset is cancelled: %v", err)
+		return "", err
+	}
 	if err != nil {
 		klog.Errorf("OpenAI returns error: %v", err)
 		var openAIErr *openai.APIError
 		if errors.As(err, &openAIErr) {
-			klog.Infof("openAIErr Message: %v", err, openAIErr.Message)
+			klog.Infof("openAIErr Message: %v", openAIErr.Message)
 			if openAIErr.Code != nil {
 				klog.Infof("openAIErr Code: %v", openAIErr.Code)
 			}
@@ -114,6 +235,10 @@ func (s *Shared) Reset() (string, error) {
 
 	reply := output.Choices[0].Message
 	s.SaveSummary(reply.Content)
+	if s.LongTerm != nil {
+		// The memorization outlives the reset, so it isn't bound to ctx.
+		go s.LongTerm.Memorize(context.Background(), conversation)
+	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -127,7 +252,7 @@ func (s *Shared) Reset() (string, error) {
 func (s *Shared) SaveSummary(summary string) {
 	s.musummary.Lock()
 	defer s.musummary.Unlock()
-	if err := os.WriteFile(filepath.Join(s.Opts.PersistentDir, summaryFile), []byte(summary), 0644); err != nil {
+	if err := os.WriteFile(s.summaryPath(), []byte(summary), 0644); err != nil {
 		klog.Errorf("Failed to write summary: %v", err)
 	}
 }
@@ -135,7 +260,7 @@ func (s *Shared) SaveSummary(summary string) {
 func (s *Shared) LoadSummary() {
 	s.musummary.Lock()
 	defer s.musummary.Unlock()
-	summary, err := os.ReadFile(filepath.Join(s.Opts.PersistentDir, summaryFile))
+	summary, err := os.ReadFile(s.summaryPath())
 	if err != nil {
 		klog.Errorf("Failed to read summary: %v", err)
 		return
@@ -143,6 +268,120 @@ func (s *Shared) LoadSummary() {
 	s.Remember("assistant", string(summary), []string{})
 }
 
+func (s *Shared) summaryPath() string {
+	if s.SummaryFile != "" {
+		return filepath.Join(s.Opts.PersistentDir, s.SummaryFile)
+	}
+	return filepath.Join(s.Opts.PersistentDir, summaryFile)
+}
+
+// Unremember removes the latest exchange of content and reply, and returns false if it's not found,
+// e.g. the memories have been reset.
+func (s *Shared) Unremember(content, reply string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(content, reply)
+	if i < 0 {
+		return false
+	}
+	s.messages = append(s.messages[:i], s.messages[i+2:]...)
+	return true
+}
+
+// Continue requests the continuation of the reply to content, and appends it to the reply in the memories.
+func (s *Shared) Continue(ctx context.Context, content, reply string) (string, error) {
+	s.mu.RLock()
+	found := s.find(content, reply) >= 0
+	s.mu.RUnlock()
+	if !found {
+		return "", ErrNotRemembered
+	}
+	messages := s.Messages(ctx)
+	messages = append(messages, openai.ChatCompletionMessage{Role: "user", Content: continueText})
+	output, err := s.createChatCompletion(ctx, s.ChatCompletionRequest(messages))
+	if err != nil {
+		klog.Errorf("OpenAI returns error: %v", err)
+		return "", err
+	}
+	continuation := output.Choices[0].Message.Content
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.find(content, reply); i >= 0 {
+		reply, _ = splitSources(reply)
+		s.messages[i+1] = *ChatCompletionMessage("assistant", reply+continuation, []string{})
+	}
+	return continuation, nil
+}
+
+// find returns the index of the latest exchange of content and reply in the memories, or -1 if not found.
+// The reply is remembered without the sources.
+func (s *Shared) find(content, reply string) int {
+	reply, _ = splitSources(reply)
+	for i := len(s.messages) - 2; i >= 0; i-- {
+		user, assistant := s.messages[i], s.messages[i+1]
+		if user.Role == "user" && assistant.Role == "assistant" && messageText(user) == content && messageText(assistant) == reply {
+			return i
+		}
+	}
+	return -1
+}
+
+// sources returns the list of the documents cited in the reply to be appended to it.
+// The brackets in the code blocks and the code spans aren't citations.
+func sources(reply string, documents []Document) string {
+	var cited []int
+	seen := map[int]bool{}
+	fence := false
+	for _, line := range strings.Split(reply, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fence = !fence
+			continue
+		}
+		if fence {
+			continue
+		}
+		for _, m := range citationRegexp.FindAllStringSubmatch(codeSpanRegexp.ReplaceAllString(line, ""), -1) {
+			n, _ := strconv.Atoi(m[1])
+			if n >= 1 && n <= len(documents) && !seen[n] {
+				seen[n] = true
+				cited = append(cited, n)
+			}
+		}
+	}
+	if len(cited) == 0 {
+		return ""
+	}
+	sort.Ints(cited)
+	text := "\n\nSources:"
+	for _, n := range cited {
+		text += fmt.Sprintf("\n- [%d] %s", n, documents[n-1].Source)
+	}
+	return text
+}
+
+// splitSources splits the reply into the text and the sources appended to it.
+func splitSources(reply string) (string, string) {
+	loc := sourcesRegexp.FindStringIndex(reply)
+	if loc == nil {
+		return reply, ""
+	}
+	return reply[:loc[0]], reply[loc[0]:]
+}
+
+// messageText returns the text of the message without the images.
+func messageText(m openai.ChatCompletionMessage) string {
+	if m.Content != "" {
+		return m.Content
+	}
+	for _, part := range m.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeText {
+			return part.Text
+		}
+	}
+	return ""
+}
+
 func (s *Shared) Forget(num int) {
 	klog.Infof("Try forget the old memries")
 	s.mu.Lock()
@@ -153,11 +392,13 @@ func (s *Shared) Forget(num int) {
 	s.messages = s.messages[num:]
 }
 
-func (s *Shared) Messages() []openai.ChatCompletionMessage {
+// Messages returns the memories following the system text rendered with the vars of ctx.
+func (s *Shared) Messages(ctx context.Context) []openai.ChatCompletionMessage {
+	systemText := s.RenderSystemText(s.Vars(ctx))
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	rtn := make([]openai.ChatCompletionMessage, len(s.messages)+1)
-	rtn[0] = openai.ChatCompletionMessage{Role: "system", Content: s.SystemText}
+	rtn[0] = openai.ChatCompletionMessage{Role: "system", Content: systemText}
 
 	for i := range s.messages {
 		rtn[i+1] = s.messages[i]
@@ -165,25 +406,43 @@ func (s *Shared) Messages() []openai.ChatCompletionMessage {
 	return rtn
 }
 
-func (s *Shared) Reply(role, content string, fileDataUrls []string) (string, error) {
+func (s *Shared) Reply(ctx context.Context, role, content string, fileDataUrls []string) (string, error) {
 	klog.Infof("Requesting chat completions...: %v", content)
-	temperature := s.Temperature
-	messages := s.Messages()
+	messages := s.Messages(ctx)
+	if s.LongTerm != nil {
+		if facts := s.LongTerm.Recall(ctx, content); len(facts) > 0 {
+			messages[0].Content += "\n\n" + recallText + "- " + strings.Join(facts, "\n- ")
+		}
+	}
+	if vars := s.Vars(ctx); vars.UserProfile != "" {
+		messages[0].Content += "\n\n" + fmt.Sprintf(profileText, vars.UserName) + vars.UserProfile
+	}
+	var documents []Document
+	if s.Knowledge != nil {
+		documents = s.Knowledge.Search(ctx, content)
+		for i, d := range documents {
+			if i == 0 {
+				messages[0].Content += "\n\n" + knowledgeText
+			}
+			messages[0].Content += fmt.Sprintf("\n[%d] %s\n%s\n", i+1, d.Source, d.Text)
+		}
+	}
 	messages = append(messages, *ChatCompletionMessage(role, content, fileDataUrls))
 
-	output, err := s.OpenAI.CreateChatCompletion(
-		context.TODO(),
-		openai.ChatCompletionRequest{
-			Model:       model,
-			Messages:    messages,
-			Temperature: temperature,
-		},
-	)
+	output, err := s.createChatCompletion(ctx, s.ChatCompletionRequest(messages))
+	if errors.Is(err, budget.ErrExceeded) {
+		klog.Warningf("Skip chat completions: %v", err)
+		return s.LimitText(), err
+	}
+	if ctx.Err() != nil {
+		klog.Infof("Chat completions are cancelled: %v", err)
+		return "", err
+	}
 	if err != nil {
 		klog.Errorf("OpenAI returns error: %v", err)
 		var openAIErr *openai.APIError
 		if errors.As(err, &openAIErr) {
-			klog.Infof("openAIErr Message: %v", err, openAIErr.Message)
+			klog.Infof("openAIErr Message: %v", openAIErr.Message)
 			if openAIErr.Code != nil {
 				klog.Infof("openAIErr Code: %v", openAIErr.Code)
 			}
@@ -195,27 +454,87 @@ func (s *Shared) Reply(role, content string, fileDataUrls []string) (string, err
 
 	reply := output.Choices[0].Message
 	s.Remember(role, content, fileDataUrls)
+	// The sources are shown to the users but aren't remembered, so the model doesn't imitate them.
 	s.Remember(reply.Role, reply.Content, []string{})
+	reply.Content += sources(reply.Content, documents)
 
 	if output.Usage.TotalTokens > 2*8096 {
-		go s.Reset()
+		// The reset outlives the reply, so it isn't bound to ctx.
+		go s.Reset(context.Background())
 	}
 
 	return reply.Content, nil
 }
 
-func (s *Shared) ChatCompletions(messages []openai.ChatCompletionMessage) (*openai.ChatCompletionResponse, error) {
-	temperature := s.Temperature
-	response, err := s.OpenAI.CreateChatCompletion(
-		context.TODO(),
-		openai.ChatCompletionRequest{
-			Model:       model,
-			Messages:    messages,
-			Temperature: temperature,
-		},
-	)
+func (s *Shared) ChatCompletions(ctx context.Context, messages []openai.ChatCompletionMessage) (*openai.ChatCompletionResponse, error) {
+	response, err := s.createChatCompletion(ctx, s.ChatCompletionRequest(messages))
 	if err != nil {
 		return nil, err
 	}
 	return &response, nil
 }
+
+// Vars returns the prompt vars of ctx at the current time of the character.
+func (s *Shared) Vars(ctx context.Context) *prompt.Vars {
+	vars := prompt.VarsFrom(ctx, s.Location())
+	vars.BotName = s.Name
+	return vars
+}
+
+// FormatText renders the textFormat of the character with the message of the user.
+func (s *Shared) FormatText(ctx context.Context, user, content string) string {
+	vars := s.Vars(ctx)
+	vars.UserName = user
+	vars.Content = content
+	return s.RenderTextFormat(vars)
+}
+
+// ChatCompletionRequest returns the request of messages with the model and the sampling parameters of the character.
+func (s *Shared) ChatCompletionRequest(messages []openai.ChatCompletionMessage) openai.ChatCompletionRequest {
+	request := openai.ChatCompletionRequest{
+		Model:            s.Model,
+		Messages:         messages,
+		Temperature:      s.Temperature,
+		MaxTokens:        s.MaxTokens,
+		TopP:             s.TopP,
+		PresencePenalty:  s.PresencePenalty,
+		FrequencyPenalty: s.FrequencyPenalty,
+		Stop:             s.Stop,
+		Seed:             s.Seed,
+	}
+	if request.Model == "" {
+		request.Model = defaultModel
+	}
+	if s.ResponseFormat != "" {
+		request.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatType(s.ResponseFormat),
+		}
+	}
+	return request
+}
+
+// LimitText returns the text to refuse requests over the rate limits or the budget.
+func (s *Shared) LimitText() string {
+	if s.Config.LimitText != "" {
+		return s.Config.LimitText
+	}
+	return s.ErrorText
+}
+
+func (s *Shared) createChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	if s.Opts.Budget.Exceeded(time.Now()) {
+		return openai.ChatCompletionResponse{}, budget.ErrExceeded
+	}
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	response, model, err := s.completeWithRetry(ctx, request)
+	if err != nil {
+		return response, err
+	}
+	// The fallback model is charged if it answered.
+	s.Opts.Budget.Record(model, response.Usage, time.Now())
+	return response, nil
+}
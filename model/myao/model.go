@@ -1,10 +1,9 @@
 package myao
 
 import (
+	"context"
 	_ "embed"
-	"fmt"
 
-	"github.com/sashabaranov/go-openai"
 	"k8s.io/klog/v2"
 
 	"github.com/yuanying/myao/model"
@@ -19,23 +18,22 @@ type Myao struct {
 }
 
 func New(opts *model.Opts) (*Myao, error) {
-	openAIConfig := openai.DefaultConfig(opts.OpenAIAccessToken)
-	if opts.OpenAIOrganizationID != "" {
-		openAIConfig.OrgID = opts.OpenAIOrganizationID
-	}
-	openAI := openai.NewClientWithConfig(openAIConfig)
+	openAI := model.NewOpenAIClient(opts)
 
 	config, err := configs.Load(opts.CharacterType)
 	if err != nil {
 		klog.Errorf("Failed to load config: %v", err)
 		return nil, err
 	}
+	opts.Overrides.Apply(config)
 
 	m := &Myao{
 		model: &model.Shared{
-			Config: config,
-			OpenAI: openAI,
-			Opts:   opts,
+			Config:    config,
+			OpenAI:    openAI,
+			Opts:      opts,
+			LongTerm:  opts.LongTerm,
+			Knowledge: opts.Knowledge,
 		},
 		Config: config,
 	}
@@ -51,6 +49,10 @@ func (m *Myao) Name() string {
 	return m.model.Name
 }
 
+func (m *Myao) LimitText() string {
+	return m.model.LimitText()
+}
+
 func (m *Myao) SaveSummary(summary string) {
 	m.model.SaveSummary(summary)
 }
@@ -59,18 +61,23 @@ func (m *Myao) LoadSummary() {
 	m.model.LoadSummary()
 }
 
-func (m *Myao) Reset() (string, error) {
-	return m.model.Reset()
+func (m *Myao) Reset(ctx context.Context) (string, error) {
+	return m.model.Reset(ctx)
 }
 
-func (m *Myao) FormatText(user, content string) string {
-	return fmt.Sprintf(m.Config.TextFormat, user, content)
+func (m *Myao) FormatText(ctx context.Context, user, content string) string {
+	return m.model.FormatText(ctx, user, content)
 }
 
 func (m *Myao) Remember(role, content string, fileDataUrls []string) {
 	m.model.Remember(role, content, fileDataUrls)
 }
 
-func (m *Myao) Reply(content string, fileDataUrls []string) (string, error) {
-	return m.model.Reply("user", content, fileDataUrls)
+func (m *Myao) Reply(ctx context.Context, content string, fileDataUrls []string) (*model.Response, error) {
+	reply, err := m.model.Reply(ctx, "user", content, fileDataUrls)
+	response := &model.Response{Text: reply}
+	if err == nil {
+		response.Turns = []model.Turn{{Memory: m.model, Content: content, Reply: reply}}
+	}
+	return response, err
 }
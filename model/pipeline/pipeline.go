@@ -0,0 +1,243 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+	"k8s.io/klog/v2"
+
+	"github.com/yuanying/myao/model"
+	"github.com/yuanying/myao/model/budget"
+	"github.com/yuanying/myao/model/configs"
+	"github.com/yuanying/myao/model/correction"
+	"github.com/yuanying/myao/model/prompt"
+)
+
+var _ model.Model = (*Pipeline)(nil)
+
+// Pipeline replies by the stages declared in the pipeline of the character config.
+type Pipeline struct {
+	model  *model.Shared
+	Config *configs.Config
+
+	stages map[string]*model.Shared
+	// primary is the first stage remembering the conversation, which owns the summary of the pipeline.
+	primary *model.Shared
+}
+
+func New(opts *model.Opts) (*Pipeline, error) {
+	config, err := configs.Load(opts.CharacterType)
+	if err != nil {
+		klog.Errorf("Failed to load config: %v", err)
+		return nil, err
+	}
+	if config.Pipeline == nil {
+		return nil, fmt.Errorf("character doesn't have a pipeline: %v", opts.CharacterType)
+	}
+	return newPipeline(config, model.NewOpenAIClient(opts), opts), nil
+}
+
+// newPipeline returns the pipeline of the config replying by openAI.
+func newPipeline(config *configs.Config, openAI *openai.Client, opts *model.Opts) *Pipeline {
+	opts.Overrides.Apply(config)
+
+	p := &Pipeline{
+		model: &model.Shared{
+			Config: config,
+			OpenAI: openAI,
+			Opts:   opts,
+		},
+		Config: config,
+		stages: map[string]*model.Shared{},
+	}
+	for _, stage := range config.Pipeline.Stages {
+		c := stage.Config()
+		opts.Overrides.Apply(c)
+		s := &model.Shared{
+			Config: c,
+			OpenAI: openAI,
+			Opts:   opts,
+		}
+		if stage.Remembers() {
+			if p.primary == nil {
+				p.primary = s
+				s.LongTerm, s.Knowledge = opts.LongTerm, opts.Knowledge
+			} else {
+				s.SummaryFile = fmt.Sprintf("summary-%v.txt", stage.Name)
+			}
+		}
+		p.stages[stage.Name] = s
+	}
+
+	p.LoadSummary()
+	p.each(func(s *model.Shared) {
+		for _, msg := range s.InitConversations {
+			s.Remember(msg.Role, msg.Content, []string{})
+		}
+	})
+	return p
+}
+
+// each calls f with the stages remembering the conversation.
+func (p *Pipeline) each(f func(s *model.Shared)) {
+	for _, stage := range p.Config.Pipeline.Stages {
+		if stage.Remembers() {
+			f(p.stages[stage.Name])
+		}
+	}
+}
+
+func (p *Pipeline) Name() string {
+	return p.model.Name
+}
+
+func (p *Pipeline) LimitText() string {
+	return p.model.LimitText()
+}
+
+func (p *Pipeline) SaveSummary(summary string) {
+	if p.primary != nil {
+		p.primary.SaveSummary(summary)
+	}
+}
+
+func (p *Pipeline) LoadSummary() {
+	p.each(func(s *model.Shared) {
+		s.LoadSummary()
+	})
+}
+
+// Reset resets the memories of all stages, and returns the summary of the primary stage.
+func (p *Pipeline) Reset(ctx context.Context) (string, error) {
+	var (
+		reply string
+		err   error
+	)
+	p.each(func(s *model.Shared) {
+		r, e := s.Reset(ctx)
+		if s == p.primary {
+			reply, err = r, e
+		} else if e != nil {
+			klog.Warningf("Failed to reset stage: %v, %v", s.Name, e)
+		}
+	})
+	return reply, err
+}
+
+func (p *Pipeline) FormatText(ctx context.Context, user, content string) string {
+	return p.model.FormatText(ctx, user, content)
+}
+
+func (p *Pipeline) Remember(role, content string, fileDataUrls []string) {
+	p.each(func(s *model.Shared) {
+		s.Remember(role, content, fileDataUrls)
+	})
+}
+
+type result struct {
+	err   error
+	reply string
+}
+
+// Reply runs the groups of the stages in order, and renders the reply from their outputs.
+// The stage failing outputs its errorText, and the other stages go on.
+// The exchanges remembered by the stages are forgotten if any stage fails, as the single characters don't remember
+// the failed replies.
+func (p *Pipeline) Reply(ctx context.Context, content string, fileDataUrls []string) (*model.Response, error) {
+	vars := &prompt.StageVars{
+		Text:    content,
+		Raw:     prompt.VarsFrom(ctx, p.Config.Location()).Content,
+		Outputs: map[string]string{},
+	}
+
+	response := &model.Response{}
+	fail := func(err error) (*model.Response, error) {
+		response.Forget()
+		response.Turns = nil
+		return response, err
+	}
+	var errs []error
+	for _, group := range p.Config.Pipeline.Groups() {
+		results := make([]result, len(group))
+		inputs := make([]string, len(group))
+		var wg sync.WaitGroup
+		for i, stage := range group {
+			input := stage.RenderInput(vars)
+			inputs[i] = input
+			wg.Add(1)
+			go func(i int, stage *configs.Stage) {
+				defer wg.Done()
+				reply, err := p.reply(ctx, stage, input, fileDataUrls)
+				results[i] = result{err: err, reply: reply}
+			}(i, stage)
+		}
+		wg.Wait()
+		for i, stage := range group {
+			if results[i].err == nil && stage.Remembers() {
+				response.Turns = append(response.Turns, model.Turn{Memory: p.stages[stage.Name], Content: inputs[i], Reply: results[i].reply})
+			}
+		}
+		if ctx.Err() != nil {
+			return fail(ctx.Err())
+		}
+
+		for i, stage := range group {
+			res := results[i]
+			if errors.Is(res.err, budget.ErrExceeded) {
+				response.Text = p.LimitText()
+				return fail(res.err)
+			}
+			if res.err != nil {
+				klog.Warningf("Stage %v returns error: %v", stage.Name, res.err)
+				errs = append(errs, fmt.Errorf("stage %v: %w", stage.Name, res.err))
+			} else if stage.Format == configs.FormatCorrection {
+				c, err := correction.Parse(res.reply)
+				if err != nil {
+					klog.Warningf("Stage %v returns invalid correction: %v, %v", stage.Name, err, res.reply)
+					errs = append(errs, fmt.Errorf("stage %v: %w", stage.Name, err))
+					vars.Outputs[stage.Name] = p.stages[stage.Name].ErrorText
+					continue
+				}
+				response.Correction = c
+				res.reply = c.Text()
+				if c.Reply != "" {
+					res.reply = c.Reply
+				}
+			}
+			vars.Outputs[stage.Name] = res.reply
+		}
+	}
+
+	response.Text = p.Config.Pipeline.RenderOutput(vars)
+	if len(errs) > 0 {
+		return fail(errors.Join(errs...))
+	}
+	return response, nil
+}
+
+func (p *Pipeline) reply(ctx context.Context, stage *configs.Stage, input string, fileDataUrls []string) (string, error) {
+	s := p.stages[stage.Name]
+	if stage.Remembers() {
+		return s.Reply(ctx, "user", input, fileDataUrls)
+	}
+
+	messages := []openai.ChatCompletionMessage{
+		{
+			Role:    "system",
+			Content: s.RenderSystemText(s.Vars(ctx)),
+		},
+	}
+	for _, m := range s.InitConversations {
+		messages = append(messages, openai.ChatCompletionMessage{Role: m.Role, Content: m.Content})
+	}
+	messages = append(messages, *model.ChatCompletionMessage("user", input, fileDataUrls))
+
+	output, err := s.ChatCompletions(ctx, messages)
+	if err != nil {
+		return s.ErrorText, err
+	}
+	return output.Choices[0].Message.Content, nil
+}
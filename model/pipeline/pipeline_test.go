@@ -0,0 +1,121 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/yuanying/myao/model"
+	"github.com/yuanying/myao/model/configs"
+)
+
+const testConfig = `
+name: Test
+systemText: test
+errorText: error
+textFormat: "{{.Content}}"
+pipeline:
+  stages:
+  - name: first
+  - name: second
+    input: "second: {{.Outputs.first}}"
+`
+
+func TestReply(t *testing.T) {
+	tests := []struct {
+		name string
+		// fail are the prefixes of the inputs of the stages failing.
+		fail    []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "succeeded",
+			want: "reply to second: reply to hello",
+		},
+		{
+			name:    "last stage failed",
+			fail:    []string{"second:"},
+			want:    "error",
+			wantErr: true,
+		},
+		{
+			name:    "first stage failed",
+			fail:    []string{"hello"},
+			want:    "reply to second: error",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var request openai.ChatCompletionRequest
+				if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+					t.Errorf("invalid request: %v", err)
+				}
+				last := request.Messages[len(request.Messages)-1]
+				input := last.Content
+				if len(last.MultiContent) > 0 {
+					input = last.MultiContent[0].Text
+				}
+				w.Header().Set("Content-Type", "application/json")
+				for _, prefix := range tt.fail {
+					if strings.HasPrefix(input, prefix) {
+						w.WriteHeader(http.StatusBadRequest)
+						w.Write([]byte(`{"error":{"message":"failed","type":"error"}}`))
+						return
+					}
+				}
+				json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+					Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "reply to " + input}}},
+				})
+			}))
+			defer server.Close()
+
+			dir := t.TempDir()
+			file := filepath.Join(dir, "test.yaml")
+			if err := os.WriteFile(file, []byte(testConfig), 0644); err != nil {
+				t.Fatal(err)
+			}
+			config, err := configs.LoadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := openai.DefaultConfig("token")
+			client.BaseURL = server.URL + "/v1"
+			p := newPipeline(config, openai.NewClientWithConfig(client), &model.Opts{PersistentDir: dir})
+
+			response, err := p.Reply(context.Background(), "hello", nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Reply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if response.Text != tt.want {
+				t.Errorf("Reply() = %q, want %q", response.Text, tt.want)
+			}
+			if tt.wantErr {
+				if len(response.Turns) > 0 {
+					t.Errorf("Turns = %+v, want none", response.Turns)
+				}
+				for name, s := range p.stages {
+					if len(s.Messages(context.Background())) != 1 {
+						t.Errorf("stage %v remembers %+v, want only the system text", name, s.Messages(context.Background()))
+					}
+				}
+				return
+			}
+			if len(response.Turns) != 2 {
+				t.Fatalf("Turns = %+v, want 2", response.Turns)
+			}
+			if !response.Forget() || len(p.stages["first"].Messages(context.Background())) != 1 {
+				t.Errorf("Forget() doesn't forget the exchanges")
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package progress
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/yuanying/myao/model/correction"
+)
+
+const (
+	progressFile = "progress.json"
+	// retention is the period to keep the daily records.
+	retention = 90 * 24 * time.Hour
+	week      = 7 * 24 * time.Hour
+	dayLayout = "2006-01-02"
+)
+
+var (
+	// slackMarkupRegexp matches the mentions and the links of Slack.
+	slackMarkupRegexp = regexp.MustCompile(`<[^>]*>`)
+	wordRegexp        = regexp.MustCompile(`[A-Za-z]+(?:'[A-Za-z]+)?`)
+	// stopWords are too common to be listed as the most used words.
+	stopWords = map[string]bool{}
+)
+
+func init() {
+	for _, w := range strings.Fields("a an the i you he she it we they me my your is am are was were be been do does did have has had " +
+		"to of in on at for with and or but so not that this what it's i'm don't") {
+		stopWords[w] = true
+	}
+}
+
+// Tracker records the grammatical errors and the vocabulary of the learners.
+type Tracker struct {
+	dir string
+
+	// mu protects learners from concurrent access.
+	mu       sync.Mutex
+	learners map[string]*Learner
+}
+
+// Learner is the record of a user.
+type Learner struct {
+	// Days are the records per day, keyed by the date.
+	Days map[string]*Day `json:"days"`
+	// Words are the words the user has used.
+	Words map[string]*Word `json:"words"`
+}
+
+type Day struct {
+	Messages int `json:"messages"`
+	// Errors are the numbers of the errors by category.
+	Errors map[string]int `json:"errors"`
+}
+
+type Word struct {
+	Count int `json:"count"`
+	// First is the date the word is used first.
+	First string `json:"first"`
+}
+
+func New(persistentDir string) *Tracker {
+	t := &Tracker{dir: persistentDir, learners: map[string]*Learner{}}
+	data, err := os.ReadFile(t.file())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.Errorf("Failed to read progress: %v", err)
+		}
+		return t
+	}
+	if err := json.Unmarshal(data, &t.learners); err != nil {
+		klog.Errorf("Failed to parse progress: %v", err)
+	}
+	return t
+}
+
+// Record adds the correction of the message of user.
+func (t *Tracker) Record(user string, c *correction.Correction, now time.Time) {
+	if t == nil || c == nil || user == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	l, ok := t.learners[user]
+	if !ok {
+		l = &Learner{Days: map[string]*Day{}, Words: map[string]*Word{}}
+		t.learners[user] = l
+	}
+	date := now.Format(dayLayout)
+	d, ok := l.Days[date]
+	if !ok {
+		d = &Day{Errors: map[string]int{}}
+		l.Days[date] = d
+	}
+	d.Messages++
+	if c.HasErrors() {
+		for _, e := range c.Errors {
+			d.Errors[e.Category]++
+		}
+	}
+	for _, w := range words(c.Original) {
+		word, ok := l.Words[w]
+		if !ok {
+			word = &Word{First: date}
+			l.Words[w] = word
+		}
+		word.Count++
+	}
+
+	expired := now.Add(-retention).Format(dayLayout)
+	for date := range l.Days {
+		if date < expired {
+			delete(l.Days, date)
+		}
+	}
+	t.save()
+}
+
+func (t *Tracker) save() {
+	data, err := json.Marshal(t.learners)
+	if err != nil {
+		klog.Errorf("Failed to marshal progress: %v", err)
+		return
+	}
+	if err := os.WriteFile(t.file(), data, 0644); err != nil {
+		klog.Errorf("Failed to write progress: %v", err)
+	}
+}
+
+func (t *Tracker) file() string {
+	return filepath.Join(t.dir, progressFile)
+}
+
+// words returns the words in text in lower case.
+func words(text string) []string {
+	text = slackMarkupRegexp.ReplaceAllString(text, " ")
+	var rtn []string
+	for _, w := range wordRegexp.FindAllString(text, -1) {
+		if len(w) > 1 || w == "I" || w == "a" {
+			rtn = append(rtn, strings.ToLower(w))
+		}
+	}
+	return rtn
+}
+
+// Count is a number of something by name.
+type Count struct {
+	Name  string
+	Count int
+}
+
+// Report is the progress of a user.
+type Report struct {
+	// ThisWeek and LastWeek are the records of the last 7 days and the 7 days before.
+	ThisWeek Day
+	LastWeek Day
+	// Mistakes are the numbers of the errors in the retention period by category, most frequent first.
+	Mistakes []Count
+	// Words is the number of the words the user has used.
+	Words int
+	// NewWords are the words used first in the last 7 days, most used first.
+	NewWords []Count
+	// TopWords are the words most used.
+	TopWords []Count
+}
+
+// Report returns the progress of user, or nil if the user has no record.
+func (t *Tracker) Report(user string, now time.Time) *Report {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	l, ok := t.learners[user]
+	if !ok {
+		return nil
+	}
+	r := &Report{
+		ThisWeek: Day{Errors: map[string]int{}},
+		LastWeek: Day{Errors: map[string]int{}},
+		Words:    len(l.Words),
+	}
+	thisWeek := now.Add(-week).Format(dayLayout)
+	lastWeek := now.Add(-2 * week).Format(dayLayout)
+	mistakes := map[string]int{}
+	for date, d := range l.Days {
+		var w *Day
+		switch {
+		case date > thisWeek:
+			w = &r.ThisWeek
+		case date > lastWeek:
+			w = &r.LastWeek
+		}
+		if w != nil {
+			w.Messages += d.Messages
+		}
+		for category, n := range d.Errors {
+			mistakes[category] += n
+			if w != nil {
+				w.Errors[category] += n
+			}
+		}
+	}
+	r.Mistakes = sorted(mistakes)
+
+	newWords, allWords := map[string]int{}, map[string]int{}
+	for w, word := range l.Words {
+		if !stopWords[w] {
+			allWords[w] = word.Count
+		}
+		if word.First > thisWeek {
+			newWords[w] = word.Count
+		}
+	}
+	r.NewWords = sorted(newWords)
+	r.TopWords = sorted(allWords)
+	return r
+}
+
+// Total returns the number of all errors of the day.
+func (d *Day) Total() int {
+	total := 0
+	for _, n := range d.Errors {
+		total += n
+	}
+	return total
+}
+
+// Rate returns the number of errors per message.
+func (d *Day) Rate() float64 {
+	if d.Messages == 0 {
+		return 0
+	}
+	return float64(d.Total()) / float64(d.Messages)
+}
+
+func sorted(counts map[string]int) []Count {
+	rtn := make([]Count, 0, len(counts))
+	for name, n := range counts {
+		rtn = append(rtn, Count{Name: name, Count: n})
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		if rtn[i].Count != rtn[j].Count {
+			return rtn[i].Count > rtn[j].Count
+		}
+		return rtn[i].Name < rtn[j].Name
+	})
+	return rtn
+}
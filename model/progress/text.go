@@ -0,0 +1,75 @@
+package progress
+
+import (
+	"fmt"
+	"strings"
+)
+
+const maxListed = 10
+
+// ProgressText returns the weekly progress in Slack mrkdwn.
+func (r *Report) ProgressText() string {
+	var b strings.Builder
+	b.WriteString("*Weekly progress*\n")
+	fmt.Fprintf(&b, "• This week: %d messages, %d mistakes (%.2f per message)\n", r.ThisWeek.Messages, r.ThisWeek.Total(), r.ThisWeek.Rate())
+	fmt.Fprintf(&b, "• Last week: %d messages, %d mistakes (%.2f per message)\n", r.LastWeek.Messages, r.LastWeek.Total(), r.LastWeek.Rate())
+	switch {
+	case r.ThisWeek.Messages == 0:
+		b.WriteString("Let's chat in English this week!")
+	case r.LastWeek.Messages == 0:
+		b.WriteString("Keep it up!")
+	case r.ThisWeek.Rate() < r.LastWeek.Rate():
+		b.WriteString("You're making fewer mistakes than last week. Great job!")
+	case r.ThisWeek.Rate() > r.LastWeek.Rate():
+		b.WriteString("You made a few more mistakes than last week. Don't worry, keep practicing!")
+	default:
+		b.WriteString("You're as accurate as last week. Keep it up!")
+	}
+	if len(r.NewWords) > 0 {
+		fmt.Fprintf(&b, "\nYou used %d new words this week.", len(r.NewWords))
+	}
+	return b.String()
+}
+
+// MistakesText returns the most frequent types of the errors in Slack mrkdwn.
+func (r *Report) MistakesText() string {
+	if len(r.Mistakes) == 0 {
+		return "No mistakes recorded yet. Great job!"
+	}
+	var b strings.Builder
+	b.WriteString("*Most frequent mistakes*")
+	for i, m := range r.Mistakes {
+		if i == maxListed {
+			break
+		}
+		fmt.Fprintf(&b, "\n%d. %s: %d", i+1, m.Name, m.Count)
+		if n := r.ThisWeek.Errors[m.Name]; n > 0 {
+			fmt.Fprintf(&b, " (%d this week)", n)
+		}
+	}
+	return b.String()
+}
+
+// VocabularyText returns the vocabulary used in Slack mrkdwn.
+func (r *Report) VocabularyText() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*Vocabulary*\nYou have used %d different words, %d of them for the first time this week.", r.Words, len(r.NewWords))
+	if len(r.NewWords) > 0 {
+		fmt.Fprintf(&b, "\n• New words: %s", names(r.NewWords))
+	}
+	if len(r.TopWords) > 0 {
+		fmt.Fprintf(&b, "\n• Most used: %s", names(r.TopWords))
+	}
+	return b.String()
+}
+
+func names(counts []Count) string {
+	if len(counts) > maxListed {
+		counts = counts[:maxListed]
+	}
+	names := make([]string, len(counts))
+	for i, c := range counts {
+		names[i] = c.Name
+	}
+	return strings.Join(names, ", ")
+}
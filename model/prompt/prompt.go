@@ -0,0 +1,131 @@
+package prompt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Vars are the variables available in the prompt templates.
+type Vars struct {
+	// Now is the current time in the timezone of the character.
+	Now      time.Time
+	Date     string
+	Time     string
+	Weekday  string
+	Timezone string
+
+	ChannelName  string
+	ChannelTopic string
+	// UserName and UserTitle are the display name and the title of the speaker.
+	UserName  string
+	UserTitle string
+	// UserProfile is the profile of the speaker kept by the bot, or empty if unknown.
+	UserProfile string
+	BotName     string
+
+	// Content is the message text as it's posted.
+	Content string
+}
+
+type varsKey struct{}
+
+// WithVars returns the context carrying vars of the message being handled.
+func WithVars(ctx context.Context, vars *Vars) context.Context {
+	return context.WithValue(ctx, varsKey{}, vars)
+}
+
+// VarsFrom returns a copy of the vars carried by ctx, filling the current time in loc.
+func VarsFrom(ctx context.Context, loc *time.Location) *Vars {
+	vars := &Vars{}
+	if v, ok := ctx.Value(varsKey{}).(*Vars); ok {
+		*vars = *v
+	}
+	vars.SetTime(time.Now(), loc)
+	return vars
+}
+
+func (v *Vars) SetTime(now time.Time, loc *time.Location) {
+	if loc == nil {
+		loc = time.Local
+	}
+	v.Now = now.In(loc)
+	v.Date = v.Now.Format("2006-01-02")
+	v.Time = v.Now.Format("15:04")
+	v.Weekday = v.Now.Weekday().String()
+	v.Timezone = loc.String()
+}
+
+var funcs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	"quote": Quote,
+}
+
+// Quote formats text as a Slack block quote.
+func Quote(text string) string {
+	return "> " + strings.Join(strings.Split(text, "\n"), "\n> ")
+}
+
+// StageVars are the variables available in the input and output templates of the pipeline stages.
+type StageVars struct {
+	// Text is the user message formatted by the textFormat of the character.
+	Text string
+	// Raw is the user message as it's posted.
+	Raw string
+	// Outputs are the outputs of the previous stages by name.
+	Outputs map[string]string
+}
+
+// ParseStage parses the template of a pipeline stage and checks that it can be rendered with StageVars.
+// The outputs of the stages not run yet are empty.
+func ParseStage(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(funcs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Execute(io.Discard, &StageVars{Outputs: map[string]string{}}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Parse parses the prompt template and checks that it can be rendered with Vars.
+// The fragments are available as named templates, e.g. {{template "tone" .}}.
+func Parse(name, text string, fragments map[string]string) (*template.Template, error) {
+	t := template.New(name).Funcs(funcs).Option("missingkey=error")
+	for fragment, text := range fragments {
+		if _, err := t.New(fragment).Parse(text); err != nil {
+			return nil, err
+		}
+	}
+	t, err := t.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	sample := &Vars{ChannelName: "general", UserName: "user", BotName: "bot", Content: "hello"}
+	sample.SetTime(time.Now(), time.UTC)
+	if err := t.Execute(io.Discard, sample); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Render renders the template with vars. The raw text is returned if the rendering fails.
+func Render(t *template.Template, vars interface{}) string {
+	if t == nil {
+		return ""
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, vars); err != nil {
+		klog.Errorf("Failed to render %v: %v", t.Name(), err)
+		return fmt.Sprint(t.Root)
+	}
+	return b.String()
+}
@@ -0,0 +1,128 @@
+package quiz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"k8s.io/klog/v2"
+
+	"github.com/yuanying/myao/model"
+	"github.com/yuanying/myao/model/configs"
+	"github.com/yuanying/myao/model/correction"
+)
+
+const graderCharacter = "quiz-grader"
+
+// Question is a quiz made from a card.
+type Question struct {
+	Card Card
+	// Text is the question in Slack mrkdwn.
+	Text string
+	// Expected is the expected answer.
+	Expected string
+}
+
+// NewQuestion makes a fill-in-the-blank or rewrite-the-sentence question from the card, alternately by the reviews.
+func NewQuestion(card Card) *Question {
+	c := &correction.Correction{Original: card.Original, Corrected: card.Corrected}
+	hint := strings.Join(card.Categories, ", ")
+	if text, answers := c.Cloze(); card.Repetitions%2 == 0 && len(answers) > 0 {
+		return &Question{
+			Card:     card,
+			Text:     fmt.Sprintf("*Fill in the blanks* (%s)\n> %s", hint, text),
+			Expected: strings.Join(answers, " / "),
+		}
+	}
+	return &Question{
+		Card:     card,
+		Text:     fmt.Sprintf("*Rewrite the sentence correctly* (%s)\n> %s", hint, card.Original),
+		Expected: card.Corrected,
+	}
+}
+
+// Grade is the result of an answer.
+type Grade struct {
+	// Quality is the quality of the answer from 0 to 5 in SM-2.
+	Quality  int    `json:"quality"`
+	Feedback string `json:"feedback"`
+}
+
+// UnmarshalJSON decodes the grade, accepting the quality either as a number or as a string, e.g. "4".
+func (g *Grade) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Quality  json.RawMessage `json:"quality"`
+		Feedback string          `json:"feedback"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	quality := strings.Trim(strings.TrimSpace(string(raw.Quality)), `"`)
+	n, err := strconv.Atoi(strings.TrimSpace(quality))
+	if err != nil || n < 0 || n > 5 {
+		return fmt.Errorf("invalid quality: %s", raw.Quality)
+	}
+	g.Quality, g.Feedback = n, raw.Feedback
+	return nil
+}
+
+// Correct returns true if the answer passes.
+func (g *Grade) Correct() bool {
+	return g.Quality >= 3
+}
+
+// Grader grades the answers by the quiz-grader character.
+type Grader struct {
+	model *model.Shared
+}
+
+func NewGrader(opts *model.Opts) (*Grader, error) {
+	config, err := configs.Load(graderCharacter)
+	if err != nil {
+		return nil, err
+	}
+	return &Grader{
+		model: &model.Shared{
+			Config: config,
+			OpenAI: model.NewOpenAIClient(opts),
+			Opts:   opts,
+		},
+	}, nil
+}
+
+// Grade grades the answer to the question. The answer is compared with the expected one if the model fails.
+func (g *Grader) Grade(ctx context.Context, q *Question, answer string) (*Grade, error) {
+	content := fmt.Sprintf("# Quiz:\n%s\n\n# Original sentence:\n%s\n\n# Expected answer:\n%s\n\n# Explanation:\n%s\n\n# Answer of the learner:\n%s",
+		q.Text, q.Card.Original, q.Expected, q.Card.Explanation, answer)
+	messages := []openai.ChatCompletionMessage{
+		{Role: "system", Content: g.model.RenderSystemText(g.model.Vars(ctx))},
+		{Role: "user", Content: content},
+	}
+
+	output, err := g.model.ChatCompletions(ctx, messages)
+	if err != nil {
+		return compare(q, answer), err
+	}
+	grade := &Grade{}
+	if err := json.Unmarshal([]byte(output.Choices[0].Message.Content), grade); err != nil {
+		klog.Warningf("Grader returns invalid grade: %v, %v", err, output.Choices[0].Message.Content)
+		return compare(q, answer), err
+	}
+	return grade, nil
+}
+
+// compare grades the answer by comparing it with the expected one.
+func compare(q *Question, answer string) *Grade {
+	if normalize(answer) == normalize(q.Expected) {
+		return &Grade{Quality: 5, Feedback: "Correct!"}
+	}
+	return &Grade{Quality: 1, Feedback: fmt.Sprintf("The answer is: %s", q.Expected)}
+}
+
+func normalize(s string) string {
+	s = strings.ToLower(strings.Join(strings.Fields(s), " "))
+	return strings.Trim(s, ".!? ")
+}
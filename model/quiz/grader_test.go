@@ -0,0 +1,76 @@
+package quiz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/yuanying/myao/model"
+	"github.com/yuanying/myao/model/configs"
+)
+
+func TestGrade(t *testing.T) {
+	q := &Question{Card: Card{Original: "He go to school."}, Expected: "He goes to school."}
+	tests := []struct {
+		name    string
+		content string
+		answer  string
+		want    Grade
+		wantErr bool
+	}{
+		{
+			name:    "number",
+			content: `{"quality": 4, "feedback": "Good!"}`,
+			want:    Grade{Quality: 4, Feedback: "Good!"},
+		},
+		{
+			name:    "string",
+			content: `{"quality": "4", "feedback": "Good!"}`,
+			want:    Grade{Quality: 4, Feedback: "Good!"},
+		},
+		{
+			name:    "out of range",
+			content: `{"quality": 6, "feedback": "Good!"}`,
+			answer:  "he goes to school",
+			want:    Grade{Quality: 5, Feedback: "Correct!"},
+			wantErr: true,
+		},
+		{
+			name:    "not a number",
+			content: `{"quality": "perfect", "feedback": "Good!"}`,
+			answer:  "He go to school.",
+			want:    Grade{Quality: 1, Feedback: "The answer is: He goes to school."},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				content, _ := json.Marshal(tt.content)
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":%s}}]}`, content)
+			}))
+			defer server.Close()
+
+			config, err := configs.Load(graderCharacter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := openai.DefaultConfig("token")
+			client.BaseURL = server.URL + "/v1"
+			g := &Grader{model: &model.Shared{Config: config, OpenAI: openai.NewClientWithConfig(client), Opts: &model.Opts{}}}
+			got, err := g.Grade(context.Background(), q, tt.answer)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Grade() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if *got != tt.want {
+				t.Errorf("Grade() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
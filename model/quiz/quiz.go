@@ -0,0 +1,201 @@
+package quiz
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/yuanying/myao/model/correction"
+)
+
+const (
+	quizFile = "quiz.json"
+	// maxWords is the length of the messages to make cards from. The longer ones are too long to review.
+	maxWords = 40
+	// maxCards is the number of the cards kept per user. The oldest ones are dropped.
+	maxCards = 200
+
+	initialEase = 2.5
+	minEase     = 1.3
+	day         = 24 * time.Hour
+)
+
+// Card is a message corrected before, reviewed by the SM-2 algorithm.
+type Card struct {
+	ID          string   `json:"id"`
+	Original    string   `json:"original"`
+	Corrected   string   `json:"corrected"`
+	Categories  []string `json:"categories"`
+	Explanation string   `json:"explanation"`
+
+	// Repetitions is the number of the successful reviews in a row.
+	Repetitions int `json:"repetitions"`
+	// Interval is the days until the next review.
+	Interval int       `json:"interval"`
+	Ease     float64   `json:"ease"`
+	Due      time.Time `json:"due"`
+}
+
+// Deck is the cards of the users.
+type Deck struct {
+	dir string
+
+	// mu protects cards from concurrent access.
+	mu    sync.Mutex
+	cards map[string][]*Card
+}
+
+func New(persistentDir string) *Deck {
+	d := &Deck{dir: persistentDir, cards: map[string][]*Card{}}
+	data, err := os.ReadFile(d.file())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.Errorf("Failed to read quiz: %v", err)
+		}
+		return d
+	}
+	if err := json.Unmarshal(data, &d.cards); err != nil {
+		klog.Errorf("Failed to parse quiz: %v", err)
+	}
+	return d
+}
+
+// Add makes the card of the correction of the message of user, which is due tomorrow.
+func (d *Deck) Add(user string, c *correction.Correction, now time.Time) {
+	if d == nil || user == "" || !c.HasErrors() || len(strings.Fields(c.Original)) > maxWords {
+		return
+	}
+	card := &Card{
+		ID:        fmt.Sprintf("%d", now.UnixNano()),
+		Original:  c.Original,
+		Corrected: c.Corrected,
+		Ease:      initialEase,
+		Due:       now.Add(day),
+	}
+	var explanations []string
+	for _, e := range c.Errors {
+		card.Categories = appendUnique(card.Categories, e.Category)
+		explanations = append(explanations, e.Text())
+	}
+	card.Explanation = strings.Join(explanations, "\n")
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	cards := append(d.cards[user], card)
+	if len(cards) > maxCards {
+		cards = cards[len(cards)-maxCards:]
+	}
+	d.cards[user] = cards
+	d.save()
+}
+
+// Users returns the users having the cards due at now.
+func (d *Deck) Users(now time.Time) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var users []string
+	for user, cards := range d.cards {
+		for _, c := range cards {
+			if !c.Due.After(now) {
+				users = append(users, user)
+				break
+			}
+		}
+	}
+	sort.Strings(users)
+	return users
+}
+
+// Due returns the copies of up to limit cards of user due at now, the most overdue first.
+func (d *Deck) Due(user string, now time.Time, limit int) []Card {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var due []Card
+	for _, c := range d.cards[user] {
+		if !c.Due.After(now) {
+			due = append(due, *c)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].Due.Before(due[j].Due)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due
+}
+
+// Review schedules the next review of the card by the quality of the answer from 0 to 5.
+func (d *Deck) Review(user, id string, quality int, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, c := range d.cards[user] {
+		if c.ID == id {
+			c.schedule(quality, now)
+			klog.Infof("Quiz reviewed: user %v, card %v, quality %v, next in %v days", user, id, quality, c.Interval)
+			d.save()
+			return
+		}
+	}
+}
+
+// schedule updates the interval and the ease of the card by the SM-2 algorithm.
+func (c *Card) schedule(quality int, now time.Time) {
+	if quality < 0 {
+		quality = 0
+	} else if quality > 5 {
+		quality = 5
+	}
+	if quality < 3 {
+		c.Repetitions = 0
+		c.Interval = 1
+	} else {
+		switch c.Repetitions {
+		case 0:
+			c.Interval = 1
+		case 1:
+			c.Interval = 6
+		default:
+			c.Interval = int(math.Round(float64(c.Interval) * c.Ease))
+		}
+		c.Repetitions++
+	}
+	q := float64(5 - quality)
+	c.Ease += 0.1 - q*(0.08+q*0.02)
+	if c.Ease < minEase {
+		c.Ease = minEase
+	}
+	c.Due = now.Add(time.Duration(c.Interval) * day)
+}
+
+func (d *Deck) save() {
+	data, err := json.Marshal(d.cards)
+	if err != nil {
+		klog.Errorf("Failed to marshal quiz: %v", err)
+		return
+	}
+	if err := os.WriteFile(d.file(), data, 0644); err != nil {
+		klog.Errorf("Failed to write quiz: %v", err)
+	}
+}
+
+func (d *Deck) file() string {
+	return filepath.Join(d.dir, quizFile)
+}
+
+func appendUnique(s []string, v string) []string {
+	for _, e := range s {
+		if e == v {
+			return s
+		}
+	}
+	return append(s, v)
+}
@@ -0,0 +1,172 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultRequestTimeout = 60 * time.Second
+	initialBackoff        = 1 * time.Second
+	maxBackoff            = 30 * time.Second
+)
+
+type retryAfterKey struct{}
+
+// retryAfterTransport records the Retry-After header of the response,
+// because go-openai doesn't expose the headers of error responses.
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if retryAfter, ok := req.Context().Value(retryAfterKey{}).(*time.Duration); ok {
+		*retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	}
+	return resp, nil
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if sec, err := strconv.Atoi(value); err == nil {
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// NewOpenAIClient returns the OpenAI client whose responses can be retried by Shared.
+func NewOpenAIClient(opts *Opts) *openai.Client {
+	config := openai.DefaultConfig(opts.OpenAIAccessToken)
+	if opts.OpenAIOrganizationID != "" {
+		config.OrgID = opts.OpenAIOrganizationID
+	}
+	config.HTTPClient = &http.Client{
+		Transport: &retryAfterTransport{base: http.DefaultTransport},
+	}
+	return openai.NewClientWithConfig(config)
+}
+
+// retryable reports whether the request failed by a transient error.
+func retryable(err error) bool {
+	var (
+		apiErr *openai.APIError
+		reqErr *openai.RequestError
+		netErr net.Error
+	)
+	switch {
+	case errors.As(err, &apiErr):
+		if apiErr.Code == "insufficient_quota" {
+			return false
+		}
+		return retryableStatus(apiErr.HTTPStatusCode)
+	case errors.As(err, &reqErr):
+		return retryableStatus(reqErr.HTTPStatusCode)
+	case errors.Is(err, context.DeadlineExceeded):
+		return true
+	case errors.As(err, &netErr):
+		return netErr.Timeout()
+	}
+	return false
+}
+
+// unavailable reports whether the model failed by an error another model may not have,
+// i.e. the transient errors and the model not found. The invalid requests fail by any model.
+func unavailable(err error) bool {
+	var (
+		apiErr *openai.APIError
+		reqErr *openai.RequestError
+	)
+	switch {
+	case errors.As(err, &apiErr):
+		if apiErr.HTTPStatusCode == http.StatusNotFound {
+			return true
+		}
+	case errors.As(err, &reqErr):
+		if reqErr.HTTPStatusCode == http.StatusNotFound {
+			return true
+		}
+	}
+	return retryable(err)
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusRequestTimeout ||
+		code == http.StatusConflict ||
+		code == http.StatusTooManyRequests ||
+		code >= http.StatusInternalServerError
+}
+
+// backoff returns the jittered exponential backoff of the attempt, or retryAfter if it's longer.
+func backoff(attempt int, retryAfter time.Duration) time.Duration {
+	d := initialBackoff << attempt
+	if d > maxBackoff || d <= 0 {
+		d = maxBackoff
+	}
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	if retryAfter > d {
+		return retryAfter
+	}
+	return d
+}
+
+// completeWithRetry requests the chat completion, retrying transient errors with backoff
+// and falling back to the next model if the model keeps being unavailable.
+// It returns the model which answered, and gives up when ctx is done.
+func (s *Shared) completeWithRetry(ctx context.Context, request openai.ChatCompletionRequest) (response openai.ChatCompletionResponse, model string, err error) {
+	timeout := s.Opts.RequestTimeout
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
+
+	models := append([]string{request.Model}, s.Opts.FallbackModels...)
+	for i, m := range models {
+		if i > 0 {
+			klog.Warningf("Fall back to the model: %v", m)
+		}
+		request.Model = m
+		for attempt := 0; ; attempt++ {
+			var retryAfter time.Duration
+			attemptCtx, cancel := context.WithTimeout(context.WithValue(ctx, retryAfterKey{}, &retryAfter), timeout)
+			response, err = s.OpenAI.CreateChatCompletion(attemptCtx, request)
+			cancel()
+			if err == nil {
+				return response, m, nil
+			}
+			if ctx.Err() != nil {
+				return response, m, err
+			}
+			if !retryable(err) || attempt >= s.Opts.MaxRetries {
+				klog.Errorf("OpenAI returns error: %v, model %v, attempt %v", err, m, attempt+1)
+				break
+			}
+			wait := backoff(attempt, retryAfter)
+			klog.Warningf("OpenAI returns error: %v, retry in %v", err, wait)
+			select {
+			case <-ctx.Done():
+				return response, m, ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		if !unavailable(err) {
+			return response, m, err
+		}
+	}
+	return response, request.Model, err
+}
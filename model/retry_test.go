@@ -0,0 +1,129 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestCompleteWithRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		// status is the HTTP status of the responses by model. The models not in it answer.
+		status    map[string]int
+		code      string
+		want      string
+		wantCalls []string
+		wantErr   bool
+	}{
+		{
+			name:      "primary answers",
+			want:      "primary",
+			wantCalls: []string{"primary"},
+		},
+		{
+			name:      "fall back on rate limit",
+			status:    map[string]int{"primary": http.StatusTooManyRequests},
+			want:      "fallback",
+			wantCalls: []string{"primary", "fallback"},
+		},
+		{
+			name:      "fall back on server error",
+			status:    map[string]int{"primary": http.StatusServiceUnavailable},
+			want:      "fallback",
+			wantCalls: []string{"primary", "fallback"},
+		},
+		{
+			name:      "fall back on model not found",
+			status:    map[string]int{"primary": http.StatusNotFound},
+			want:      "fallback",
+			wantCalls: []string{"primary", "fallback"},
+		},
+		{
+			name:      "fall back twice",
+			status:    map[string]int{"primary": http.StatusInternalServerError, "fallback": http.StatusBadGateway},
+			want:      "last",
+			wantCalls: []string{"primary", "fallback", "last"},
+		},
+		{
+			name:      "all unavailable",
+			status:    map[string]int{"primary": 500, "fallback": 500, "last": 500},
+			want:      "last",
+			wantCalls: []string{"primary", "fallback", "last"},
+			wantErr:   true,
+		},
+		{
+			name:      "bad request",
+			status:    map[string]int{"primary": http.StatusBadRequest},
+			want:      "primary",
+			wantCalls: []string{"primary"},
+			wantErr:   true,
+		},
+		{
+			name:      "context length exceeded",
+			status:    map[string]int{"primary": http.StatusBadRequest},
+			code:      "context_length_exceeded",
+			want:      "primary",
+			wantCalls: []string{"primary"},
+			wantErr:   true,
+		},
+		{
+			name:      "unauthorized",
+			status:    map[string]int{"primary": http.StatusUnauthorized},
+			want:      "primary",
+			wantCalls: []string{"primary"},
+			wantErr:   true,
+		},
+		{
+			name:      "insufficient quota",
+			status:    map[string]int{"primary": http.StatusTooManyRequests},
+			code:      "insufficient_quota",
+			want:      "primary",
+			wantCalls: []string{"primary"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var request openai.ChatCompletionRequest
+				if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+					t.Errorf("invalid request: %v", err)
+				}
+				calls = append(calls, request.Model)
+				w.Header().Set("Content-Type", "application/json")
+				if status, ok := tt.status[request.Model]; ok {
+					w.WriteHeader(status)
+					fmt.Fprintf(w, `{"error":{"message":"failed","type":"error","code":%q}}`, tt.code)
+					return
+				}
+				fmt.Fprintf(w, `{"id":"1","model":%q,"choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`, request.Model)
+			}))
+			defer server.Close()
+
+			config := openai.DefaultConfig("token")
+			config.BaseURL = server.URL + "/v1"
+			s := &Shared{
+				OpenAI: openai.NewClientWithConfig(config),
+				Opts:   &Opts{FallbackModels: []string{"fallback", "last"}},
+			}
+			_, got, err := s.completeWithRetry(context.Background(), openai.ChatCompletionRequest{Model: "primary"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("model = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package model
+
+import "testing"
+
+func TestSources(t *testing.T) {
+	documents := []Document{{Source: "a.md"}, {Source: "b.md > Setup"}}
+	tests := []struct {
+		name  string
+		reply string
+		want  string
+	}{
+		{name: "no citations", reply: "Hello."},
+		{name: "citations", reply: "Run it [2], see [1] and [2].", want: "\n\nSources:\n- [1] a.md\n- [2] b.md > Setup"},
+		{name: "out of range", reply: "See [3] and [0]."},
+		{name: "index", reply: "Use arr[1] or m[k][2]."},
+		{name: "code span", reply: "Use `x[1]` here."},
+		{name: "code block", reply: "```go\nx := a [1]\n```\nDone [2].", want: "\n\nSources:\n- [2] b.md > Setup"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sources(tt.reply, documents)
+			if got != tt.want {
+				t.Errorf("sources() = %q, want %q", got, tt.want)
+			}
+			text, footer := splitSources(tt.reply + got)
+			if text != tt.reply || footer != got {
+				t.Errorf("splitSources() = %q, %q, want %q, %q", text, footer, tt.reply, got)
+			}
+		})
+	}
+}
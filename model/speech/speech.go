@@ -0,0 +1,102 @@
+package speech
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	BackendNone    = ""
+	BackendWhisper = "whisper"
+	BackendLocal   = "local"
+)
+
+// Transcriber converts recorded speech into text.
+type Transcriber interface {
+	Transcribe(ctx context.Context, filename string, audio io.Reader) (string, error)
+}
+
+type Opts struct {
+	// Backend selects the speech-to-text implementation.
+	// "whisper" uses the OpenAI Whisper API and "local" uses an OpenAI-compatible server at BaseURL.
+	Backend              string
+	BaseURL              string
+	Model                string
+	Language             string
+	AccessToken          string
+	OpenAIOrganizationID string
+}
+
+// New returns the Transcriber for opts.Backend, or nil if transcription is disabled.
+func New(opts *Opts) (Transcriber, error) {
+	switch opts.Backend {
+	case BackendNone:
+		return nil, nil
+	case BackendWhisper:
+		config := openai.DefaultConfig(opts.AccessToken)
+		if opts.OpenAIOrganizationID != "" {
+			config.OrgID = opts.OpenAIOrganizationID
+		}
+		if opts.BaseURL != "" {
+			config.BaseURL = opts.BaseURL
+		}
+		return newOpenAI(config, opts), nil
+	case BackendLocal:
+		if opts.BaseURL == "" {
+			return nil, fmt.Errorf("speech backend %q requires a base URL", opts.Backend)
+		}
+		config := openai.DefaultConfig(opts.AccessToken)
+		config.BaseURL = opts.BaseURL
+		return newOpenAI(config, opts), nil
+	default:
+		return nil, fmt.Errorf("unknown speech backend: %v", opts.Backend)
+	}
+}
+
+// IsAudio reports whether a Slack file with the given file type and mime type can be transcribed.
+func IsAudio(filetype, mimetype string) bool {
+	if strings.HasPrefix(mimetype, "audio/") {
+		return true
+	}
+	switch filetype {
+	case "m4a", "mp3", "mp4", "mpeg", "mpga", "ogg", "wav", "webm":
+		return true
+	}
+	return false
+}
+
+type openAITranscriber struct {
+	client   *openai.Client
+	model    string
+	language string
+}
+
+func newOpenAI(config openai.ClientConfig, opts *Opts) *openAITranscriber {
+	model := opts.Model
+	if model == "" {
+		model = openai.Whisper1
+	}
+	return &openAITranscriber{
+		client:   openai.NewClientWithConfig(config),
+		model:    model,
+		language: opts.Language,
+	}
+}
+
+func (t *openAITranscriber) Transcribe(ctx context.Context, filename string, audio io.Reader) (string, error) {
+	res, err := t.client.CreateTranscription(ctx, openai.AudioRequest{
+		Model:    t.model,
+		FilePath: filename,
+		Reader:   audio,
+		Language: t.language,
+		Format:   openai.AudioResponseFormatJSON,
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(res.Text), nil
+}
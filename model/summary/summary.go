@@ -0,0 +1,144 @@
+package summary
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/sashabaranov/go-openai"
+	"k8s.io/klog/v2"
+
+	"github.com/yuanying/myao/model"
+	"github.com/yuanying/myao/model/configs"
+)
+
+const (
+	summarizerCharacter = "summarizer"
+	separator           = "\n\n---\n\n"
+	// maxDepth is the max number of the reduce steps, which is enough for thousands of chunks.
+	maxDepth = 4
+)
+
+// Message is a message of the conversation to summarize.
+type Message struct {
+	// ID is cited in the summary as [#ID].
+	ID   int
+	Time time.Time
+	User string
+	Text string
+}
+
+func (m *Message) line(loc *time.Location) string {
+	return fmt.Sprintf("[#%d] %s @%s: %s", m.ID, m.Time.In(loc).Format("2006-01-02 15:04"), m.User, m.Text)
+}
+
+// Summarizer summarizes the conversations by the summarizer character.
+type Summarizer struct {
+	model *model.Shared
+	// chunkTokens is the number of the tokens of the messages summarized at once.
+	chunkTokens int
+	encoding    *tiktoken.Tiktoken
+}
+
+func New(opts *model.Opts, chunkTokens int) (*Summarizer, error) {
+	config, err := configs.Load(summarizerCharacter)
+	if err != nil {
+		return nil, err
+	}
+	opts.Overrides.Apply(config)
+	name := config.Model
+	if name == "" {
+		name = "gpt-4o"
+	}
+	encoding, err := tiktoken.EncodingForModel(name)
+	if err != nil {
+		klog.Warningf("Estimate the tokens by the length: %v", err)
+	}
+	return &Summarizer{
+		model: &model.Shared{
+			Config: config,
+			OpenAI: model.NewOpenAIClient(opts),
+			Opts:   opts,
+		},
+		chunkTokens: chunkTokens,
+		encoding:    encoding,
+	}, nil
+}
+
+// Summarize summarizes the messages by map-reduce. The chunks of the messages within the tokens are summarized
+// separately, and the partial summaries are merged into the digest.
+func (s *Summarizer) Summarize(ctx context.Context, messages []Message) (string, error) {
+	if len(messages) == 0 {
+		return "", fmt.Errorf("no messages to summarize")
+	}
+	lines := make([]string, len(messages))
+	for i := range messages {
+		lines[i] = messages[i].line(s.model.Location())
+	}
+	texts, err := s.summarize(ctx, "Messages", s.chunks(lines, "\n"))
+	if err != nil {
+		return "", err
+	}
+	for depth := 0; len(texts) > 1; depth++ {
+		chunks := s.chunks(texts, separator)
+		if depth == maxDepth || len(chunks) == len(texts) {
+			// The partial summaries can't be merged any more, so merge them all at once.
+			chunks = []string{strings.Join(texts, separator)}
+		}
+		klog.Infof("Reduce %v summaries into %v", len(texts), len(chunks))
+		texts, err = s.summarize(ctx, "Partial summaries", chunks)
+		if err != nil {
+			return "", err
+		}
+	}
+	return texts[0], nil
+}
+
+// summarize summarizes each chunk titled title.
+func (s *Summarizer) summarize(ctx context.Context, title string, chunks []string) ([]string, error) {
+	summaries := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		messages := []openai.ChatCompletionMessage{
+			{Role: "system", Content: s.model.RenderSystemText(s.model.Vars(ctx))},
+			{Role: "user", Content: fmt.Sprintf("# %s:\n%s", title, chunk)},
+		}
+		output, err := s.model.ChatCompletions(ctx, messages)
+		if err != nil {
+			return nil, err
+		}
+		summaries[i] = output.Choices[0].Message.Content
+	}
+	return summaries, nil
+}
+
+// chunks joins the texts by sep into the chunks within chunkTokens. A text longer than it makes a chunk by itself.
+func (s *Summarizer) chunks(texts []string, sep string) []string {
+	var (
+		chunks []string
+		chunk  []string
+		tokens int
+	)
+	for _, text := range texts {
+		n := s.tokens(text)
+		if len(chunk) > 0 && tokens+n > s.chunkTokens {
+			chunks = append(chunks, strings.Join(chunk, sep))
+			chunk, tokens = nil, 0
+		}
+		chunk = append(chunk, text)
+		tokens += n
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, strings.Join(chunk, sep))
+	}
+	return chunks
+}
+
+// tokens returns the number of the tokens of text, estimated by its length if the model is unknown to tiktoken.
+func (s *Summarizer) tokens(text string) int {
+	if s.encoding == nil {
+		return len(text)/3 + 1
+	}
+	return len(s.encoding.Encode(text, nil, nil))
+}
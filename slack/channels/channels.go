@@ -0,0 +1,95 @@
+package channels
+
+import (
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+	"k8s.io/klog/v2"
+)
+
+const cacheTTL = 10 * time.Minute
+
+type Info struct {
+	Name  string
+	Topic string
+}
+
+// Channels caches the information of the conversations.
+type Channels struct {
+	slack *slack.Client
+
+	// mu protects cache from concurrent access.
+	mu    sync.Mutex
+	cache map[string]*entry
+}
+
+type entry struct {
+	info    Info
+	fetched time.Time
+}
+
+func New(client *slack.Client) *Channels {
+	return &Channels{
+		slack: client,
+		cache: map[string]*entry{},
+	}
+}
+
+// Get returns the information of the channel. It's empty if the channel can't be fetched.
+func (c *Channels) Get(channel string) Info {
+	c.mu.Lock()
+	e, cached := c.cache[channel]
+	c.mu.Unlock()
+	if cached && time.Since(e.fetched) < cacheTTL {
+		return e.info
+	}
+	// The lock isn't held while fetching, not to block the other channels by a slow request.
+	res, err := c.slack.GetConversationInfo(&slack.GetConversationInfoInput{ChannelID: channel})
+	if err != nil {
+		klog.Errorf("Failed to get channel info: %v, %v", channel, err)
+		if cached {
+			return e.info
+		}
+		return Info{}
+	}
+	info := Info{Name: res.Name, Topic: res.Topic.Value}
+	c.mu.Lock()
+	c.cache[channel] = &entry{info: info, fetched: time.Now()}
+	c.mu.Unlock()
+	return info
+}
+
+// Find returns the ID of the public channel named name, or false if it's not found.
+func (c *Channels) Find(name string) (string, bool) {
+	c.mu.Lock()
+	for id, e := range c.cache {
+		if e.info.Name == name {
+			c.mu.Unlock()
+			return id, true
+		}
+	}
+	c.mu.Unlock()
+
+	params := &slack.GetConversationsParameters{ExcludeArchived: true, Limit: 1000, Types: []string{"public_channel"}}
+	for {
+		channels, cursor, err := c.slack.GetConversations(params)
+		if err != nil {
+			klog.Errorf("Failed to list channels: %v", err)
+			return "", false
+		}
+		for _, ch := range channels {
+			if ch.Name != name {
+				continue
+			}
+			c.mu.Lock()
+			c.cache[ch.ID] = &entry{info: Info{Name: ch.Name, Topic: ch.Topic.Value}, fetched: time.Now()}
+			c.mu.Unlock()
+			return ch.ID, true
+		}
+		if cursor == "" {
+			return "", false
+		}
+		params.Cursor = cursor
+	}
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/yuanying/myao/model"
+	"github.com/yuanying/myao/model/configs"
+	"github.com/yuanying/myao/model/prompt"
+)
+
+// Announce posts the reply of the character to the prompt of the schedule in the channel, starting a conversation,
+// or the digest of the channel if the schedule has the summary.
+// Nothing is posted if the character fails to reply.
+func (h *Handler) Announce(ctx context.Context, character, channel string, schedule *configs.Schedule) error {
+	myao, ok := h.bots[character]
+	if !ok {
+		return fmt.Errorf("character isn't loaded: %v", character)
+	}
+	if schedule.Summary > 0 {
+		return h.announceDigest(ctx, myao, channel, schedule.Summary)
+	}
+	info := h.channels.Get(channel)
+	vars := &prompt.Vars{
+		ChannelName:  info.Name,
+		ChannelTopic: info.Topic,
+		BotName:      myao.Name(),
+	}
+	text := schedule.RenderPrompt(vars)
+	vars.Content = text
+	ctx = prompt.WithVars(ctx, vars)
+
+	response, err := myao.Reply(ctx, text, nil)
+	if err != nil {
+		return err
+	}
+	posted, snippets, err := h.postResponse(channel, "", response)
+	if err != nil {
+		return err
+	}
+	h.track(posted, &exchange{
+		bot:      myao,
+		channel:  channel,
+		text:     text,
+		vars:     vars,
+		reply:    response.Text,
+		snippets: snippets,
+		response: response,
+	})
+	h.policy.Replied(channel, time.Now())
+	return nil
+}
+
+// announceDigest posts the digest of the conversation in the channel for the hours.
+// Nothing is posted if the channel has been silent.
+func (h *Handler) announceDigest(ctx context.Context, myao model.Model, channel string, hours int) error {
+	if h.summarizer == nil {
+		return fmt.Errorf("summarization is disabled")
+	}
+	if hours > maxSummaryHours {
+		hours = maxSummaryHours
+	}
+	text, err := h.digest(ctx, myao, channel, "", hours, "")
+	if errors.Is(err, errNoMessages) {
+		klog.Infof("No messages to summarize in %v", channel)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, _, err = h.postResponse(channel, "", &model.Response{Text: text})
+	return err
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/slack-go/slack"
+
+	"github.com/yuanying/myao/model"
+	"github.com/yuanying/myao/model/correction"
+	"github.com/yuanying/myao/slack/mrkdwn"
+)
+
+const (
+	// sectionLimit is the max length of the text of a section block.
+	sectionLimit = 3000
+	// messageSections is the number of the sections per message, keeping the text within 40000 characters.
+	messageSections = 10
+	// messageBlocks is the max number of the blocks per message.
+	messageBlocks = 50
+)
+
+// message is a message to be posted, or a snippet to be uploaded if snippet is set.
+type message struct {
+	text    string
+	blocks  []slack.Block
+	snippet *mrkdwn.Snippet
+}
+
+// messages renders the response into the messages of the sections, the snippets of the long code blocks,
+// and the correction following the reply.
+func (h *Handler) messages(response *model.Response) []message {
+	var (
+		messages []message
+		sections []string
+	)
+	flush := func() {
+		if len(sections) == 0 {
+			return
+		}
+		m := message{text: strings.Join(sections, "\n\n")}
+		for _, s := range sections {
+			m.blocks = append(m.blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, s, false, false), nil, nil))
+		}
+		messages = append(messages, m)
+		sections = nil
+	}
+	for _, part := range mrkdwn.Render(response.Text, h.snippetLines) {
+		if part.Snippet != nil {
+			flush()
+			messages = append(messages, message{snippet: part.Snippet})
+			continue
+		}
+		// The @names of the members are converted into the mentions before split, which makes them longer.
+		for _, s := range mrkdwn.Split(h.users.Mentions(part.Text), sectionLimit) {
+			if len(sections) == messageSections {
+				flush()
+			}
+			sections = append(sections, s)
+		}
+	}
+	flush()
+
+	if !response.Correction.HasErrors() {
+		return messages
+	}
+	c := escaped(response.Correction)
+	blocks := correctionBlocks(c)
+	if n := len(messages); n > 0 && messages[n-1].snippet == nil && len(messages[n-1].blocks)+len(blocks) <= messageBlocks {
+		messages[n-1].text += "\n\n" + c.Text()
+		messages[n-1].blocks = append(messages[n-1].blocks, blocks...)
+		return messages
+	}
+	return append(messages, message{text: c.Text(), blocks: blocks})
+}
+
+// escaped returns the copy of the correction escaped for mrkdwn,
+// so that the words of the users and the model don't mention anyone.
+func escaped(c *correction.Correction) *correction.Correction {
+	e := *c
+	e.Original = mrkdwn.Escape(c.Original)
+	e.Corrected = mrkdwn.Escape(c.Corrected)
+	e.Errors = make([]correction.Error, len(c.Errors))
+	for i, err := range c.Errors {
+		e.Errors[i] = correction.Error{
+			Category:    mrkdwn.Escape(err.Category),
+			Span:        mrkdwn.Escape(err.Span),
+			Explanation: mrkdwn.Escape(err.Explanation),
+		}
+	}
+	return &e
+}
+
+// correctionBlocks renders the escaped correction as a diff of the message followed by the explanations of the errors.
+func correctionBlocks(c *correction.Correction) []slack.Block {
+	blocks := []slack.Block{slack.NewDividerBlock()}
+	for _, text := range mrkdwn.Split("*Correction*\n"+c.Diff(), sectionLimit) {
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil))
+	}
+	var elements []slack.MixedElement
+	for _, e := range c.Errors {
+		elements = append(elements, slack.NewTextBlockObject(slack.MarkdownType, truncate(e.Text(), sectionLimit), false, false))
+	}
+	// Context blocks can contain up to 10 elements.
+	for len(elements) > 0 {
+		n := len(elements)
+		if n > 10 {
+			n = 10
+		}
+		blocks = append(blocks, slack.NewContextBlock("", elements[:n]...))
+		elements = elements[n:]
+	}
+	return blocks
+}
+
+// truncate cuts the text longer than limit runes with an ellipsis.
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/slack-go/slack"
+
+	"github.com/yuanying/myao/model/correction"
+)
+
+func TestCorrectionBlocks(t *testing.T) {
+	long := strings.Repeat("word ", 1000)
+	tests := []struct {
+		name       string
+		correction *correction.Correction
+		contains   []string
+		excludes   []string
+	}{
+		{
+			name: "mentions are escaped",
+			correction: &correction.Correction{
+				Original:  "<!channel> I has a <@U123> & you",
+				Corrected: "<!channel> I have a <@U123> & you",
+				Errors:    []correction.Error{{Category: "agreement", Span: "<!here> has", Explanation: "use <@U456> & have"}},
+			},
+			contains: []string{"&lt;!channel&gt;", "&lt;@U123&gt;", "&amp;", "&lt;!here&gt; has", "use &lt;@U456&gt; &amp; have"},
+			excludes: []string{"<!channel>", "<@U123>", "<!here>", "<@U456>"},
+		},
+		{
+			name: "long texts are within the limit",
+			correction: &correction.Correction{
+				Original:  long + "I has",
+				Corrected: long + "I have",
+				Errors:    []correction.Error{{Category: "agreement", Span: "has", Explanation: long}},
+			},
+			contains: []string{"*Correction*", "~has~ *have*"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var texts []string
+			for _, block := range correctionBlocks(escaped(tt.correction)) {
+				switch b := block.(type) {
+				case *slack.SectionBlock:
+					texts = append(texts, b.Text.Text)
+				case *slack.ContextBlock:
+					for _, e := range b.ContextElements.Elements {
+						texts = append(texts, e.(*slack.TextBlockObject).Text)
+					}
+				}
+			}
+			for _, text := range texts {
+				if n := utf8.RuneCountInString(text); n > sectionLimit {
+					t.Errorf("text has %v characters over %v", n, sectionLimit)
+				}
+			}
+			all := strings.Join(texts, "\n")
+			for _, s := range tt.contains {
+				if !strings.Contains(all, s) {
+					t.Errorf("blocks don't contain %q: %v", s, all)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(all, s) {
+					t.Errorf("blocks contain %q: %v", s, all)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"github.com/slack-go/slack"
+	"k8s.io/klog/v2"
+
+	"github.com/yuanying/myao/model"
+	"github.com/yuanying/myao/model/prompt"
+)
+
+// EditCommand regenerates, continues or undoes the last reply in the conversation.
+// The messages of the reply are replaced, and the exchange in the memories as well.
+// The reply is kept as it is if the edit fails.
+func (h *Handler) EditCommand(ctx context.Context, command, thread, channel string) {
+	x, response := h.claim(channel, thread)
+	if x == nil {
+		h.post(channel, thread, "No reply to "+command[1:]+".")
+		return
+	}
+	// The claim is released with the response replacing the old one, or the old one if the edit fails.
+	defer func() {
+		h.release(x, response)
+	}()
+	ctx = prompt.WithVars(ctx, x.vars)
+
+	switch command {
+	case "/undo":
+		response.Forget()
+		h.replace(x, nil)
+		response = nil
+		return
+	case "/continue":
+		continued, err := response.Continue(ctx)
+		if err != nil {
+			klog.Errorf("Myao continue error: %v", err)
+			if errors.Is(err, model.ErrNotRemembered) {
+				h.post(channel, thread, "The reply is no longer in my memories.")
+			}
+			return
+		}
+		h.replace(x, continued)
+		response = continued
+	default:
+		regenerated, err := x.bot.Reply(ctx, x.text, x.files)
+		if ctx.Err() != nil {
+			klog.Infof("Regenerate is cancelled: %v", x.text)
+			return
+		}
+		if err != nil {
+			klog.Errorf("Myao regenerate error: %v", err)
+			h.post(channel, thread, "Sorry, I couldn't regenerate the reply.")
+			return
+		}
+		response.Forget()
+		h.replace(x, regenerated)
+		response = regenerated
+	}
+}
+
+// claim takes the response of the last reply in the conversation not to be edited concurrently.
+func (h *Handler) claim(channel, thread string) (*exchange, *model.Response) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := len(h.posted) - 1; i >= 0; i-- {
+		x, ok := h.exchanges[h.posted[i]]
+		if !ok || x.channel != channel || x.thread != thread {
+			continue
+		}
+		if x.response == nil {
+			return nil, nil
+		}
+		response := x.response
+		x.response = nil
+		return x, response
+	}
+	return nil, nil
+}
+
+// release gives back the response claimed, or the one replacing it.
+func (h *Handler) release(x *exchange, response *model.Response) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	x.response = response
+}
+
+// replace updates the messages of the reply with the response, or deletes them if the response is nil.
+// The messages are posted or deleted if the number of them changes.
+func (h *Handler) replace(x *exchange, response *model.Response) {
+	var messages []message
+	if response != nil {
+		messages = h.messages(response)
+	}
+	old := x.posted
+	var posted, snippets []string
+	for _, m := range messages {
+		if m.snippet != nil {
+			file, blocks, _ := h.upload(x.channel, x.thread, m.snippet)
+			if file != "" {
+				snippets = append(snippets, file)
+			}
+			posted = append(posted, blocks...)
+			continue
+		}
+		msgOpts := []slack.MsgOption{slack.MsgOptionText(m.text, false), slack.MsgOptionBlocks(m.blocks...)}
+		if len(old) > 0 {
+			if _, _, _, err := h.slack.UpdateMessage(x.channel, old[0], msgOpts...); err != nil {
+				klog.Errorf("Slack update message error: %v", err)
+			} else {
+				posted = append(posted, old[0])
+			}
+			old = old[1:]
+			continue
+		}
+		if ts, err := h.postMessage(x.channel, x.thread, msgOpts...); err == nil {
+			posted = append(posted, ts)
+		}
+	}
+	for _, ts := range old {
+		if _, _, err := h.slack.DeleteMessage(x.channel, ts); err != nil {
+			klog.Errorf("Slack delete message error: %v", err)
+		}
+	}
+	for _, file := range x.snippets {
+		if err := h.slack.DeleteFile(file); err != nil {
+			klog.Errorf("Slack delete file error: %v", err)
+		}
+	}
+
+	h.mu.Lock()
+	for _, ts := range x.posted {
+		delete(h.exchanges, exchangeKey(x.channel, ts))
+	}
+	x.snippets = snippets
+	if response != nil {
+		x.reply = response.Text
+	}
+	h.mu.Unlock()
+	if response != nil {
+		h.track(posted, x)
+	}
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/slack-go/slack/slackevents"
+	"k8s.io/klog/v2"
+
+	"github.com/yuanying/myao/model/feedback"
+	"github.com/yuanying/myao/model/prompt"
+)
+
+// maxExchanges is the number of the recent replies accepting the feedbacks.
+const maxExchanges = 1000
+
+// React handles the feedback given by the reaction to the reply of the character.
+// The negative feedback removes the exchange from the memories, and the retry regenerates the reply.
+func (h *Handler) React(ctx context.Context, event *slackevents.ReactionAddedEvent) {
+	if event.ItemUser != h.myaoID || event.Item.Type != "message" {
+		return
+	}
+	kind := h.feedback.Kind(event.Reaction)
+	if kind == "" {
+		return
+	}
+
+	h.mu.Lock()
+	x, ok := h.exchanges[exchangeKey(event.Item.Channel, event.Item.Timestamp)]
+	if !ok {
+		h.mu.Unlock()
+		klog.Infof("Ignore feedback to unknown reply: %v, %v", event.Item.Channel, event.Item.Timestamp)
+		return
+	}
+	response, reply := x.response, x.reply
+	// The retry calls the model for the user reacting, and the reply isn't forgotten if it's limited.
+	limited := kind == feedback.Retry && response != nil && h.limited(event.User, x.channel)
+	if kind != feedback.Positive && !limited {
+		x.response = nil
+	}
+	h.mu.Unlock()
+
+	klog.Infof("Feedback: %v, %v, %v", kind, event.User, event.Item.Timestamp)
+	h.feedback.Record(&feedback.Entry{
+		Time:      time.Now(),
+		Kind:      kind,
+		Reaction:  event.Reaction,
+		User:      event.User,
+		Character: x.bot.Name(),
+		Channel:   x.channel,
+		Message:   event.Item.Timestamp,
+		Speaker:   x.user,
+		Prompt:    x.text,
+		Reply:     reply,
+	})
+	if response == nil {
+		// The exchange has been forgotten by the former feedback.
+		return
+	}
+	if limited {
+		h.post(x.channel, x.thread, x.bot.LimitText())
+		return
+	}
+	switch kind {
+	case feedback.Negative:
+		if !response.Forget() {
+			klog.Infof("Exchange is no longer in the memories: %v", event.Item.Timestamp)
+		}
+	case feedback.Retry:
+		response.Forget()
+		go h.retry(ctx, x)
+	}
+}
+
+// retry regenerates the reply of the exchange, and posts it to the conversation.
+func (h *Handler) retry(ctx context.Context, x *exchange) {
+	ctx = prompt.WithVars(ctx, x.vars)
+	response, err := x.bot.Reply(ctx, x.text, x.files)
+	if ctx.Err() != nil {
+		klog.Infof("Retry is cancelled: %v", x.text)
+		return
+	}
+	if err != nil {
+		klog.Errorf("Myao retry error: %v", err)
+	}
+	posted, snippets, err := h.postResponse(x.channel, x.thread, response)
+	if err != nil {
+		return
+	}
+	retried := *x
+	retried.reply = response.Text
+	retried.snippets = snippets
+	retried.response = response
+	h.track(posted, &retried)
+}
+
+// track keeps the exchange of the messages posted to accept the feedbacks.
+func (h *Handler) track(posted []string, x *exchange) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	x.posted = posted
+	for _, ts := range posted {
+		key := exchangeKey(x.channel, ts)
+		h.exchanges[key] = x
+		h.posted = append(h.posted, key)
+	}
+	for len(h.posted) > maxExchanges {
+		delete(h.exchanges, h.posted[0])
+		h.posted = h.posted[1:]
+	}
+}
+
+func exchangeKey(channel, ts string) string {
+	return channel + "/" + ts
+}
@@ -5,7 +5,7 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
-	"math/rand"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -15,26 +15,96 @@ import (
 	"k8s.io/klog/v2"
 
 	"github.com/yuanying/myao/model"
+	"github.com/yuanying/myao/model/budget"
+	"github.com/yuanying/myao/model/feedback"
+	"github.com/yuanying/myao/model/progress"
+	"github.com/yuanying/myao/model/prompt"
+	"github.com/yuanying/myao/model/speech"
+	"github.com/yuanying/myao/model/summary"
+	"github.com/yuanying/myao/slack/channels"
+	"github.com/yuanying/myao/slack/mrkdwn"
+	"github.com/yuanying/myao/slack/policy"
+	"github.com/yuanying/myao/slack/profiles"
+	"github.com/yuanying/myao/slack/router"
+	"github.com/yuanying/myao/slack/tutor"
 	"github.com/yuanying/myao/slack/users"
 )
 
 type Opts struct {
-	Myao                model.Model
-	Slack               *slack.Client
-	SlackUsers          *users.Users
-	MaxDelayReplyPeriod time.Duration
+	// Bots are the characters by name, selected per channel by Router.
+	Bots        map[string]model.Model
+	Router      *router.Router
+	Slack       *slack.Client
+	SlackUsers  *users.Users
+	Channels    *channels.Channels
+	Policy      *policy.Engine
+	Transcriber speech.Transcriber
+	// UserLimiter and ChannelLimiter limit the replies per user and per channel.
+	UserLimiter    *budget.Limiter
+	ChannelLimiter *budget.Limiter
+	// Progress records the grammatical errors of the users corrected by the characters.
+	Progress *progress.Tracker
+	// Tutor quizzes the users on their past mistakes. The quizzes are disabled if nil.
+	Tutor *tutor.Tutor
+	// SnippetLines is the number of lines of the code blocks in the replies to be uploaded as snippets. Disabled if 0.
+	SnippetLines int
+	// Feedback records the feedbacks given by the reactions to the replies. The feedbacks are ignored if nil.
+	Feedback *feedback.Recorder
+	// Summarizer summarizes the conversations on /summarize. The summaries are disabled if nil.
+	Summarizer *summary.Summarizer
+	// SummaryHours is the default period to summarize.
+	SummaryHours int
+	// Profiles keeps the profiles of the users given to the characters. The profiles are disabled if nil.
+	Profiles *profiles.Profiler
 }
 
 type Handler struct {
-	myao                model.Model
-	myaoID              string
-	slack               *slack.Client
-	users               *users.Users
-	maxDeplyReplyPeriod time.Duration
+	bots        map[string]model.Model
+	router      *router.Router
+	myaoID      string
+	teamURL     string
+	slack       *slack.Client
+	users       *users.Users
+	channels    *channels.Channels
+	policy      *policy.Engine
+	transcriber speech.Transcriber
 
-	// mu protects cancel from concurrent access.
-	mu     sync.Mutex
-	cancel context.CancelFunc
+	userLimiter    *budget.Limiter
+	channelLimiter *budget.Limiter
+	progress       *progress.Tracker
+	tutor          *tutor.Tutor
+	snippetLines   int
+	feedback       *feedback.Recorder
+	summarizer     *summary.Summarizer
+	profiles       *profiles.Profiler
+
+	defaultSummaryHours int
+
+	// mu protects cancels and exchanges from concurrent access.
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+	// exchanges are the recent replies keyed by the channel and the timestamp of the posted messages.
+	exchanges map[string]*exchange
+	// posted are the keys of exchanges in the order posted.
+	posted []string
+}
+
+// exchange is a reply of a character and the message it replied to.
+type exchange struct {
+	bot     model.Model
+	channel string
+	thread  string
+	user    string
+	text    string
+	files   []string
+	vars    *prompt.Vars
+	reply   string
+	// posted are the timestamps of the messages of the reply.
+	posted []string
+	// snippets are the IDs of the files of the snippets of the reply.
+	snippets []string
+	// response is nil after it's forgotten, or while it's edited.
+	response *model.Response
 }
 
 func New(opts *Opts) (*Handler, error) {
@@ -44,23 +114,46 @@ func New(opts *Opts) (*Handler, error) {
 	}
 
 	h := &Handler{
-		users:               opts.SlackUsers,
-		myao:                opts.Myao,
-		myaoID:              bot.UserID,
-		slack:               opts.Slack,
-		maxDeplyReplyPeriod: opts.MaxDelayReplyPeriod,
+		users:          opts.SlackUsers,
+		bots:           opts.Bots,
+		router:         opts.Router,
+		myaoID:         bot.UserID,
+		teamURL:        bot.URL,
+		slack:          opts.Slack,
+		channels:       opts.Channels,
+		policy:         opts.Policy,
+		transcriber:    opts.Transcriber,
+		userLimiter:    opts.UserLimiter,
+		channelLimiter: opts.ChannelLimiter,
+		progress:       opts.Progress,
+		tutor:          opts.Tutor,
+		snippetLines:   opts.SnippetLines,
+		feedback:       opts.Feedback,
+		summarizer:     opts.Summarizer,
+		profiles:       opts.Profiles,
+		cancels:        map[string]context.CancelFunc{},
+		exchanges:      map[string]*exchange{},
+
+		defaultSummaryHours: opts.SummaryHours,
 	}
 
 	return h, nil
 }
 
-func (h *Handler) Handle(event interface{}) {
+// Handle handles the Slack event. Replies in progress are cancelled when ctx is done.
+func (h *Handler) Handle(ctx context.Context, event interface{}) {
 	switch event := event.(type) {
 	case *slackevents.AppMentionEvent:
 		klog.Infof("AppMentionEvent: user -> %v,  text -> %v", event.User, event.Text)
 	case *slackevents.MessageEvent:
 		klog.Infof("MessageEvent: bot-> %v, user-> %v, text -> %v", event.BotID, event.User, event.Text)
-		h.Reply(event)
+		h.Reply(ctx, event)
+	case *slackevents.TeamJoinEvent:
+		h.users.Update(event.User)
+	case *users.UserChangeEvent:
+		h.users.Update(event.User)
+	case *slackevents.ReactionAddedEvent:
+		h.React(ctx, event)
 	}
 }
 
@@ -69,113 +162,393 @@ func convertToDataURL(fileContent []byte, mimeType string) string {
 	return fmt.Sprintf("data:%s;base64,%s", mimeType, encoded)
 }
 
-func (h *Handler) Reply(event *slackevents.MessageEvent) {
+func (h *Handler) Reply(ctx context.Context, event *slackevents.MessageEvent) {
 	if event.BotID != "" {
 		return
 	}
-	if event.Text == "" {
+	if event.Text == "" && len(event.Files) == 0 {
 		return
 	}
-	fileDataUrls := make([]string, len(event.Files))
-	if event.Files != nil && len(fileDataUrls) > 0 {
-		for i, file := range event.Files {
-			if file.Filetype == "png" || file.Filetype == "jpg" || file.Filetype == "jpeg" || file.Filetype == "gif" {
-				var buf bytes.Buffer
-				err := h.slack.GetFile(file.URLPrivate, &buf)
-				if err != nil {
-					fmt.Printf("Failed to download: %v, %v\n", file.URLPrivate, err)
-					continue
-				}
+	// A new message in the channel supersedes the pending or in-flight reply.
+	h.mu.Lock()
+	if cancel, ok := h.cancels[event.Channel]; ok {
+		cancel()
+	}
+	replyCtx, cancel := context.WithCancel(ctx)
+	h.cancels[event.Channel] = cancel
+	h.mu.Unlock()
 
-				dataURL := convertToDataURL(buf.Bytes(), file.Mimetype)
-				fileDataUrls[i] = dataURL
+	// The files are downloaded and transcribed, and the channel is routed by its name, out of the event loop.
+	go func() {
+		myao, ok := h.bot(event.Channel)
+		fileDataUrls := h.attach(replyCtx, event)
+		if event.Text == "" {
+			return
+		}
+		// Answers to the quizzes are graded by the tutor, even in the channels denied to the characters.
+		// The grading isn't superseded by the next message.
+		if h.tutor.Answer(ctx, event) {
+			return
+		}
+		if !ok {
+			klog.Infof("Ignore message in denied channel: %v", event.Channel)
+			return
+		}
+		h.reply(prompt.WithVars(replyCtx, h.promptVars(event)), ctx, myao, event.Channel, event.ThreadTimeStamp, event, fileDataUrls)
+	}()
+}
+
+// attach returns the images of the message in the data URLs, and adds the transcripts of the audio to the text.
+func (h *Handler) attach(ctx context.Context, event *slackevents.MessageEvent) []string {
+	var (
+		fileDataUrls []string
+		transcripts  []string
+	)
+	for _, file := range event.Files {
+		switch {
+		case file.Filetype == "png" || file.Filetype == "jpg" || file.Filetype == "jpeg" || file.Filetype == "gif":
+			var buf bytes.Buffer
+			err := h.slack.GetFileContext(ctx, file.URLPrivate, &buf)
+			if err != nil {
+				klog.Errorf("Failed to download: %v, %v", file.URLPrivate, err)
+				continue
 			}
+
+			dataURL := convertToDataURL(buf.Bytes(), file.Mimetype)
+			fileDataUrls = append(fileDataUrls, dataURL)
+		case h.transcriber != nil && speech.IsAudio(file.Filetype, file.Mimetype):
+			transcript, err := h.transcribe(ctx, file)
+			if err != nil {
+				klog.Errorf("Failed to transcribe: %v, %v", file.URLPrivate, err)
+				continue
+			}
+			klog.Infof("Transcript: %v", transcript)
+			transcripts = append(transcripts, transcript)
 		}
 	}
-	// event.ThreadTimeStamp
+	if len(transcripts) > 0 {
+		event.Text = strings.TrimSpace(strings.Join(append([]string{event.Text}, transcripts...), "\n"))
+		// The blocks don't have the transcripts.
+		event.Blocks = slack.Blocks{}
+	}
+	return fileDataUrls
+}
 
-	h.mu.Lock()
-	if h.cancel != nil {
-		h.cancel()
+// promptVars returns the vars of the prompt templates about the channel and the speaker.
+func (h *Handler) promptVars(event *slackevents.MessageEvent) *prompt.Vars {
+	channel := h.channels.Get(event.Channel)
+	return &prompt.Vars{
+		ChannelName:  channel.Name,
+		ChannelTopic: channel.Topic,
+		UserName:     h.users.Name(event.User),
+		UserTitle:    h.users.Title(event.User),
+		UserProfile:  h.profiles.Get(event.User).Text(),
+		Content:      event.Text,
 	}
+}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	h.cancel = cancel
-	h.mu.Unlock()
+// text returns the message for the character in Markdown, resolving the mentions, the channels and the links.
+func (h *Handler) text(ctx context.Context, myao model.Model, event *slackevents.MessageEvent) string {
+	resolver := h.resolver(myao)
+	text, ok := mrkdwn.FromBlocks(event.Blocks, resolver)
+	if !ok {
+		text = mrkdwn.ToMarkdown(event.Text, resolver)
+	}
+	if user := h.users.Name(event.User); user != "" {
+		text = myao.FormatText(ctx, user, text)
+	}
+	return text
+}
 
-	// go h.reply(ctx, event.Channel, event.ThreadTimeStamp, h.users.Text(h.myaoID, h.myao, event), fileDataUrls)
-	go h.reply(ctx, event.Channel, event.ThreadTimeStamp, event, fileDataUrls)
+// resolver resolves the names of the members, the character and the channels.
+func (h *Handler) resolver(myao model.Model) *mrkdwn.Resolver {
+	return &mrkdwn.Resolver{
+		User: func(id string) string {
+			if id == h.myaoID {
+				return myao.Name()
+			}
+			return h.users.Name(id)
+		},
+		Channel: func(id string) string {
+			return h.channels.Get(id).Name
+		},
+	}
+}
+
+// limited takes the rate limits of the user and the channel for a call of the model,
+// and returns true without taking them if either is exceeded.
+func (h *Handler) limited(user, channel string) bool {
+	now := time.Now()
+	if !h.userLimiter.Ready(user, now) || !h.channelLimiter.Ready(channel, now) {
+		klog.Warningf("Rate limit exceeded: user %v, channel %v", user, channel)
+		return true
+	}
+	h.userLimiter.Take(user, now)
+	h.channelLimiter.Take(channel, now)
+	return false
+}
+
+// bot returns the character bound to the channel, or false if the channel is denied.
+func (h *Handler) bot(channel string) (model.Model, bool) {
+	character, ok := h.router.Route(channel)
+	if !ok {
+		return nil, false
+	}
+	myao, ok := h.bots[character]
+	if !ok {
+		klog.Errorf("Character isn't loaded: %v", character)
+	}
+	return myao, ok
+}
+
+func (h *Handler) transcribe(ctx context.Context, file slackevents.File) (string, error) {
+	var buf bytes.Buffer
+	if err := h.slack.GetFileContext(ctx, file.URLPrivate, &buf); err != nil {
+		return "", err
+	}
+	// The transcription API detects the audio format from the file extension.
+	name := file.Name
+	if filepath.Ext(name) == "" {
+		name = fmt.Sprintf("%v.%v", file.ID, file.Filetype)
+	}
+	return h.transcriber.Transcribe(ctx, name, &buf)
 }
 
-func (h *Handler) reply(ctx context.Context, channel, thread string, event *slackevents.MessageEvent, fileDataUrls []string) {
-	sec := 5
-	text := h.users.Text(h.myaoID, h.myao, event)
+// reply replies to the message. lifetime is the context of the handler, which outlives ctx superseded by the next message.
+func (h *Handler) reply(ctx, lifetime context.Context, myao model.Model, channel, thread string, event *slackevents.MessageEvent, fileDataUrls []string) {
+	delay := 5 * time.Second
+	mentioned := true
+	text := h.text(ctx, myao, event)
 
-	if !strings.Contains(event.Text, h.myao.Name()) && !strings.Contains(event.Text, fmt.Sprintf("@%v", h.myaoID)) {
-		seed := time.Now().UnixNano()
-		rand.Seed(seed)
-		sec = rand.Intn(int(h.maxDeplyReplyPeriod.Seconds()))
-		klog.Infof("Waiting reply %v seconds", sec)
+	if !strings.Contains(event.Text, myao.Name()) && !strings.Contains(event.Text, fmt.Sprintf("@%v", h.myaoID)) {
+		var engage bool
+		mentioned = false
+		delay, engage = h.policy.Engage(channel, event.Text, time.Now())
+		if !engage {
+			h.profiles.Observe(event.User, text)
+			myao.Remember("user", text, fileDataUrls)
+			klog.Infof("Skip message by policy: %v", text)
+			return
+		}
+		klog.Infof("Waiting reply %v", delay)
 	} else {
 		command := strings.Fields(event.Text)
 		if len(command) > 1 {
 			if command[1] == "/help" {
-				reply := "Available commands:\n/help - Show this help\n/reset - Reset the old memories\n"
-				msgOpts := []slack.MsgOption{slack.MsgOptionText(reply, false)}
-				if thread != "" {
-					msgOpts = append(msgOpts, slack.MsgOptionTS(thread))
+				reply := "Available commands:\n/help - Show this help\n/reset - Reset the old memories\n/cancel - Cancel the reply in progress\n" +
+					"/regenerate - Regenerate the last reply\n/continue - Continue the last reply cut off\n/undo - Undo the last exchange\n" +
+					"/summarize [hours] - Summarize the conversation in the thread or the channel\n" +
+					"/profile [forget|remember] - Show or forget what I know about you, or let me learn about you again\n" +
+					"/progress - Show your weekly progress in English\n/mistakes - Show your most frequent mistakes\n/vocabulary - Show the words you have used\n"
+				h.post(channel, thread, reply)
+				return
+			} else if command[1] == "/reset" {
+				if h.limited(event.User, channel) {
+					h.post(channel, thread, myao.LimitText())
+					return
 				}
-				if _, _, err := h.slack.PostMessage(channel, msgOpts...); err != nil {
-					klog.Errorf("Slack post message error: %v", err)
+				h.ResetCommand(ctx, myao, thread, channel)
+				return
+			} else if command[1] == "/progress" || command[1] == "/mistakes" || command[1] == "/vocabulary" {
+				h.ProgressCommand(event.User, command[1], thread, channel)
+				return
+			} else if command[1] == "/regenerate" || command[1] == "/continue" || command[1] == "/undo" {
+				// Undo doesn't call the model.
+				if command[1] != "/undo" && h.limited(event.User, channel) {
+					h.post(channel, thread, myao.LimitText())
 					return
 				}
+				h.EditCommand(ctx, command[1], thread, channel)
 				return
-			} else if command[1] == "/reset" {
-				h.ResetCommand(thread, channel)
+			} else if command[1] == "/summarize" || (!strings.HasPrefix(command[1], "/") && h.wantsSummary(event.Text, channel)) {
+				if h.summarizer != nil && h.limited(event.User, channel) {
+					h.post(channel, thread, myao.LimitText())
+					return
+				}
+				// The summary takes long, so it isn't superseded by the next message.
+				h.SummarizeCommand(prompt.WithVars(lifetime, prompt.VarsFrom(ctx, time.Local)), myao, event, thread, channel)
+				return
+			} else if command[1] == "/profile" {
+				h.ProfileCommand(event.User, command[2:], thread, channel)
+				return
+			} else if command[1] == "/cancel" {
+				// This message has already cancelled the reply in progress.
+				klog.Infof("Cancelled the reply in %v", channel)
 				return
 			}
 		}
 	}
 
+	h.profiles.Observe(event.User, text)
 	select {
 	case <-ctx.Done():
-		h.myao.Remember("user", text, fileDataUrls)
+		myao.Remember("user", text, fileDataUrls)
 		klog.Infof("Skip message: %v", text)
-	case <-time.After(time.Duration(sec) * time.Second):
-		reply, err := h.myao.Reply(text, fileDataUrls)
-		msgOpts := []slack.MsgOption{slack.MsgOptionText(reply, false)}
-		if thread != "" {
-			msgOpts = append(msgOpts, slack.MsgOptionTS(thread))
+	case <-time.After(delay):
+		if !mentioned && !h.policy.Ready(channel, time.Now()) {
+			myao.Remember("user", text, fileDataUrls)
+			klog.Infof("Skip message by policy: %v", text)
+			return
+		}
+		if h.limited(event.User, channel) {
+			myao.Remember("user", text, fileDataUrls)
+			if mentioned {
+				h.post(channel, thread, myao.LimitText())
+			}
+			return
+		}
+		response, err := myao.Reply(ctx, text, fileDataUrls)
+		if ctx.Err() != nil {
+			myao.Remember("user", text, fileDataUrls)
+			klog.Infof("Reply is cancelled: %v", text)
+			return
 		}
-
 		if err != nil {
 			klog.Errorf("Myao reply error: %v", err)
 		}
-		klog.Infof("OpenAPI reply: %v", reply)
-		if _, _, err := h.slack.PostMessage(channel, msgOpts...); err != nil {
-			klog.Errorf("Slack post message error: %v", err)
+		klog.Infof("OpenAPI reply: %v", response.Text)
+		if err == nil {
+			h.progress.Record(event.User, response.Correction, time.Now())
+			h.tutor.Learn(event.User, response.Correction)
+		}
+		posted, snippets, err := h.postResponse(channel, thread, response)
+		if err != nil {
 			return
 		}
+		h.track(posted, &exchange{
+			bot:      myao,
+			channel:  channel,
+			thread:   thread,
+			user:     event.User,
+			text:     text,
+			files:    fileDataUrls,
+			vars:     prompt.VarsFrom(ctx, time.Local),
+			reply:    response.Text,
+			snippets: snippets,
+			response: response,
+		})
+		h.policy.Replied(channel, time.Now())
 	}
 }
 
-func (h *Handler) ResetCommand(thread string, channel string) {
-	reply, err := h.myao.Reset()
-	msgOpts := []slack.MsgOption{slack.MsgOptionText(reply, false)}
-	if thread != "" {
-		msgOpts = append(msgOpts, slack.MsgOptionTS(thread))
-	}
-
+func (h *Handler) ResetCommand(ctx context.Context, myao model.Model, thread string, channel string) {
+	reply, err := myao.Reset(ctx)
 	if err != nil {
 		klog.Errorf("Myao reset error: %v", err)
 	}
 	if reply != "" {
-		if _, _, err := h.slack.PostMessage(channel, msgOpts...); err != nil {
-			klog.Errorf("Slack post message error: %v", err)
-			return
-		}
+		h.postResponse(channel, thread, &model.Response{Text: reply})
 	} else {
 		klog.Infof("reply doesn't exist")
 	}
 	return
 }
+
+// ProgressCommand posts the progress of the user in English.
+func (h *Handler) ProgressCommand(user, command, thread, channel string) {
+	report := h.progress.Report(user, time.Now())
+	if report == nil {
+		h.post(channel, thread, "No progress recorded yet. Let's chat in English!")
+		return
+	}
+	switch command {
+	case "/mistakes":
+		h.post(channel, thread, report.MistakesText())
+	case "/vocabulary":
+		h.post(channel, thread, report.VocabularyText())
+	default:
+		h.post(channel, thread, report.ProgressText())
+	}
+}
+
+// ProfileCommand posts the profile of the user, forgets it, or starts profiling the user forgotten again.
+func (h *Handler) ProfileCommand(user string, args []string, thread, channel string) {
+	if h.profiles == nil {
+		h.post(channel, thread, "Profiles are disabled.")
+		return
+	}
+	if len(args) > 0 && args[0] == "forget" {
+		h.profiles.Forget(user)
+		h.post(channel, thread, "I've forgotten your profile, and won't learn about you until you ask me to remember.")
+		return
+	}
+	if len(args) > 0 && args[0] == "remember" {
+		h.profiles.Remember(user)
+		h.post(channel, thread, "OK, I'll learn about you from your messages again.")
+		return
+	}
+	text := h.profiles.Get(user).Text()
+	if text == "" {
+		h.post(channel, thread, "I don't know much about you yet. Let's chat more!")
+		return
+	}
+	h.postResponse(channel, thread, &model.Response{Text: text})
+}
+
+func (h *Handler) post(channel, thread, text string) error {
+	_, err := h.postMessage(channel, thread, slack.MsgOptionText(text, false))
+	return err
+}
+
+// postResponse posts the response split into the messages within the limits of Slack,
+// and returns the timestamps of the messages posted and the IDs of the snippets uploaded.
+func (h *Handler) postResponse(channel, thread string, response *model.Response) (posted, snippets []string, err error) {
+	for _, m := range h.messages(response) {
+		if m.snippet != nil {
+			file, blocks, err := h.upload(channel, thread, m.snippet)
+			if err != nil {
+				return posted, snippets, err
+			}
+			if file != "" {
+				snippets = append(snippets, file)
+			}
+			posted = append(posted, blocks...)
+			continue
+		}
+		ts, err := h.postMessage(channel, thread, slack.MsgOptionText(m.text, false), slack.MsgOptionBlocks(m.blocks...))
+		if err != nil {
+			return posted, snippets, err
+		}
+		posted = append(posted, ts)
+	}
+	return posted, snippets, nil
+}
+
+// postMessage posts the message, and returns its timestamp.
+func (h *Handler) postMessage(channel, thread string, msgOpts ...slack.MsgOption) (string, error) {
+	if thread != "" {
+		msgOpts = append(msgOpts, slack.MsgOptionTS(thread))
+	}
+	_, ts, err := h.slack.PostMessage(channel, msgOpts...)
+	if err != nil {
+		klog.Errorf("Slack post message error: %v", err)
+		return "", err
+	}
+	return ts, nil
+}
+
+// upload uploads the snippet, or posts it as the code blocks if failed, e.g. without the files:write scope.
+// It returns the ID of the file uploaded, or the timestamps of the code blocks posted.
+func (h *Handler) upload(channel, thread string, snippet *mrkdwn.Snippet) (string, []string, error) {
+	file, err := h.slack.UploadFileV2(slack.UploadFileV2Parameters{
+		Channel:         channel,
+		ThreadTimestamp: thread,
+		Filename:        snippet.Filename,
+		Title:           snippet.Filename,
+		Content:         snippet.Code,
+		FileSize:        len(snippet.Code),
+	})
+	if err == nil {
+		return file.ID, nil, nil
+	}
+	klog.Errorf("Failed to upload snippet: %v", err)
+	var posted []string
+	for _, text := range mrkdwn.Split("```\n"+snippet.Code+"\n```", sectionLimit) {
+		ts, err := h.postMessage(channel, thread, slack.MsgOptionText(text, false))
+		if err != nil {
+			return "", posted, err
+		}
+		posted = append(posted, ts)
+	}
+	return "", posted, nil
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/yuanying/myao/model/budget"
+)
+
+func TestLimited(t *testing.T) {
+	h := &Handler{
+		userLimiter:    budget.NewLimiter(1, 2),
+		channelLimiter: budget.NewLimiter(1, 3),
+	}
+	tests := []struct {
+		user, channel string
+		want          bool
+	}{
+		{user: "U1", channel: "C1", want: false},
+		{user: "U1", channel: "C1", want: false},
+		// The user has run out of the burst.
+		{user: "U1", channel: "C1", want: true},
+		// The channel has a token left, which isn't taken by the user limited.
+		{user: "U2", channel: "C1", want: false},
+		{user: "U2", channel: "C1", want: true},
+		{user: "U2", channel: "C2", want: false},
+	}
+	for i, tt := range tests {
+		if got := h.limited(tt.user, tt.channel); got != tt.want {
+			t.Errorf("#%d limited(%v, %v) = %v, want %v", i, tt.user, tt.channel, got, tt.want)
+		}
+	}
+	if (&Handler{}).limited("U1", "C1") {
+		t.Errorf("limited() is true without the limiters")
+	}
+}
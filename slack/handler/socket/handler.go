@@ -2,12 +2,15 @@ package socket
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/slack-go/slack/slackevents"
 	"github.com/slack-go/slack/socketmode"
 	"k8s.io/klog/v2"
 
+	"github.com/yuanying/myao/model/configs"
 	"github.com/yuanying/myao/slack/handler"
+	"github.com/yuanying/myao/slack/users"
 )
 
 type Handler struct {
@@ -40,10 +43,12 @@ func (h *Handler) Run(ctx context.Context) {
 				switch event.Type {
 				case slackevents.CallbackEvent:
 					klog.Infof("CallbackEVent: %v", event)
-					h.innerHandler.Handle(event.InnerEvent.Data)
+					h.innerHandler.Handle(ctx, event.InnerEvent.Data)
 				default:
 					klog.Warningf("Unsupported event: %v", event.Type)
 				}
+			case socketmode.EventTypeErrorBadMessage:
+				h.handleUnknownEvent(ctx, socket, socketEvent.Data.(*socketmode.ErrorBadMessage))
 			case socketmode.EventTypeHello:
 				klog.Infof("EventTypeHello")
 			default:
@@ -54,3 +59,32 @@ func (h *Handler) Run(ctx context.Context) {
 
 	socket.RunContext(ctx)
 }
+
+// Announce posts by the schedule of the character. See handler.Handler.Announce.
+func (h *Handler) Announce(ctx context.Context, character, channel string, schedule *configs.Schedule) error {
+	return h.innerHandler.Announce(ctx, character, channel, schedule)
+}
+
+// handleUnknownEvent handles the events slackevents can't parse, such as user_change.
+func (h *Handler) handleUnknownEvent(ctx context.Context, socket *socketmode.Client, bad *socketmode.ErrorBadMessage) {
+	req := socketmode.Request{}
+	if err := json.Unmarshal(bad.Message, &req); err != nil || req.Type != socketmode.RequestTypeEventsAPI {
+		klog.Warningf("Bad socket message: %v", bad.Cause)
+		return
+	}
+	socket.Ack(req)
+
+	var payload struct {
+		Event json.RawMessage `json:"event"`
+	}
+	event := &users.UserChangeEvent{}
+	if err := json.Unmarshal(req.Payload, &payload); err != nil {
+		klog.Warningf("Bad event: %v", err)
+		return
+	}
+	if err := json.Unmarshal(payload.Event, event); err != nil || event.Type != "user_change" {
+		klog.Warningf("Unsupported event: %v", bad.Cause)
+		return
+	}
+	h.innerHandler.Handle(ctx, event)
+}
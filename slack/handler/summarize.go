@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"k8s.io/klog/v2"
+
+	"github.com/yuanying/myao/model"
+	"github.com/yuanying/myao/model/summary"
+	"github.com/yuanying/myao/slack/mrkdwn"
+)
+
+const (
+	// maxSummaryHours bounds the period to summarize.
+	maxSummaryHours = 7 * 24
+	// maxSummaryMessages bounds the messages fetched to summarize.
+	maxSummaryMessages = 2000
+	// summaryTimeout bounds the time to fetch and summarize the messages.
+	summaryTimeout = 10 * time.Minute
+)
+
+var (
+	summaryIntentRegexp = regexp.MustCompile(`(?i)\b(summarize|summarise|summary|recap|tl;?dr)\b|要約|まとめて`)
+	// summaryTargetRegexp matches the words referring to the conversation here, e.g. "this thread" or "the last 3 hours".
+	summaryTargetRegexp = regexp.MustCompile(`(?i)\b(this|the|our)\s+(thread|channel|conversation|discussion|chat)\b|` +
+		`\b(last|past)\s+(\d+\s*)?(hours?|hrs?|days?|week)\b|\btoday\b|スレッド|チャンネル|会話|ここ|\d+\s*(時間|日)|今日`)
+	summaryHoursRegexp = regexp.MustCompile(`(?i)(\d+)\s*(hours?|hrs?|h\b|時間)`)
+	summaryDaysRegexp  = regexp.MustCompile(`(?i)(\d+)\s*(days?|日)`)
+	// slackMarkupRegexp matches the mentions, the channels and the links in the messages.
+	slackMarkupRegexp = regexp.MustCompile(`<[^<>]*>`)
+	citationRegexp    = regexp.MustCompile(`\[#(\d+)\]`)
+)
+
+// wantsSummary returns true if the message asks for the summary of the conversation in the channel,
+// e.g. "summarize this thread" or "recap #general". The summaries of the other topics are asked to the character,
+// and the messages with links are asking for the summaries of the linked pages.
+func (h *Handler) wantsSummary(text, channel string) bool {
+	if h.summarizer == nil || !summaryIntentRegexp.MatchString(text) || strings.Contains(text, "http") {
+		return false
+	}
+	return summaryTargetRegexp.MatchString(text) || strings.Contains(text, "<#"+channel)
+}
+
+// summaryHours returns the period to summarize asked in the text, e.g. "/summarize 6" or "3 days".
+// The argument of the command takes precedence over the period in the words.
+func (h *Handler) summaryHours(text string) int {
+	hours := h.defaultSummaryHours
+	// The mentions and the links, e.g. "<@U04AB12CD3H>", aren't the periods.
+	text = slackMarkupRegexp.ReplaceAllString(text, " ")
+	explicit := false
+	if command := strings.Fields(text); len(command) > 1 && command[0] == "/summarize" {
+		if n, err := strconv.Atoi(command[1]); err == nil {
+			hours, explicit = n, true
+		}
+	}
+	if m := summaryHoursRegexp.FindStringSubmatch(text); !explicit && m != nil {
+		hours, _ = strconv.Atoi(m[1])
+	} else if m := summaryDaysRegexp.FindStringSubmatch(text); !explicit && m != nil {
+		days, _ := strconv.Atoi(m[1])
+		hours = days * 24
+	}
+	if hours <= 0 {
+		hours = h.defaultSummaryHours
+	}
+	if hours > maxSummaryHours {
+		hours = maxSummaryHours
+	}
+	return hours
+}
+
+// errNoMessages is returned if there is no message to summarize.
+var errNoMessages = errors.New("no messages to summarize")
+
+// SummarizeCommand posts the digest of the thread, or the channel if not in a thread, for the hours asked.
+// ctx should outlive the reply to the message.
+func (h *Handler) SummarizeCommand(ctx context.Context, myao model.Model, event *slackevents.MessageEvent, thread, channel string) {
+	if h.summarizer == nil {
+		h.post(channel, thread, "Summarization is disabled.")
+		return
+	}
+	hours := h.summaryHours(event.Text)
+	text, err := h.digest(ctx, myao, channel, thread, hours, event.TimeStamp)
+	switch {
+	case errors.Is(err, context.Canceled):
+		klog.Infof("Summarize is cancelled: %v", channel)
+		return
+	case errors.Is(err, errNoMessages):
+		h.post(channel, thread, fmt.Sprintf("No messages in the last %d hours.", hours))
+		return
+	case err != nil:
+		klog.Errorf("Summarize error: %v", err)
+		h.post(channel, thread, "Sorry, I couldn't summarize the conversation this time.")
+		return
+	}
+	h.postResponse(channel, thread, &model.Response{Text: text})
+}
+
+// digest summarizes the messages of the thread, or the channel if thread is empty, in the hours before latest.
+// The key messages cited in the digest are linked.
+func (h *Handler) digest(ctx context.Context, myao model.Model, channel, thread string, hours int, latest string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, summaryTimeout)
+	defer cancel()
+	oldest := fmt.Sprintf("%d.000000", time.Now().Add(-time.Duration(hours)*time.Hour).Unix())
+	history, err := h.history(ctx, channel, thread, oldest, latest)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the conversation: %w", err)
+	}
+
+	resolver := h.resolver(myao)
+	var (
+		messages []summary.Message
+		links    = map[string]string{}
+	)
+	for _, msg := range history {
+		if msg.SubType == "channel_join" || msg.SubType == "channel_leave" || msg.Text == "" {
+			continue
+		}
+		user := resolver.User(msg.User)
+		if user == "" {
+			user = msg.Username
+		}
+		id := len(messages) + 1
+		messages = append(messages, summary.Message{
+			ID:   id,
+			Time: timestamp(msg.Timestamp),
+			User: user,
+			Text: mrkdwn.ToMarkdown(msg.Text, resolver),
+		})
+		links[strconv.Itoa(id)] = h.permalink(channel, msg.Timestamp, msg.ThreadTimestamp)
+	}
+	if len(messages) == 0 {
+		return "", errNoMessages
+	}
+	klog.Infof("Summarize %v messages in %v for %v hours", len(messages), channel, hours)
+
+	text, err := h.summarizer.Summarize(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	return citationRegexp.ReplaceAllStringFunc(text, func(citation string) string {
+		link, ok := links[citationRegexp.FindStringSubmatch(citation)[1]]
+		if !ok || link == "" {
+			return citation
+		}
+		return fmt.Sprintf("%s(%s)", citation, link)
+	}), nil
+}
+
+// history returns the messages of the thread, or the channel if thread is empty, between oldest and latest
+// in the order posted.
+func (h *Handler) history(ctx context.Context, channel, thread, oldest, latest string) ([]slack.Message, error) {
+	var (
+		messages []slack.Message
+		cursor   string
+	)
+	for len(messages) < maxSummaryMessages {
+		if thread != "" {
+			msgs, hasMore, next, err := h.slack.GetConversationRepliesContext(ctx, &slack.GetConversationRepliesParameters{
+				ChannelID: channel,
+				Timestamp: thread,
+				Cursor:    cursor,
+				Oldest:    oldest,
+				Latest:    latest,
+				Limit:     200,
+			})
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, msgs...)
+			if !hasMore || next == "" {
+				break
+			}
+			cursor = next
+			continue
+		}
+		res, err := h.slack.GetConversationHistoryContext(ctx, &slack.GetConversationHistoryParameters{
+			ChannelID: channel,
+			Cursor:    cursor,
+			Oldest:    oldest,
+			Latest:    latest,
+			Limit:     200,
+		})
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, res.Messages...)
+		if !res.HasMore || res.ResponseMetaData.NextCursor == "" {
+			break
+		}
+		cursor = res.ResponseMetaData.NextCursor
+	}
+	if thread == "" {
+		// The history is in the reverse order, newest first, unlike the replies.
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	return messages, nil
+}
+
+// permalink returns the link to the message, or empty if the URL of the workspace is unknown.
+func (h *Handler) permalink(channel, ts, thread string) string {
+	if h.teamURL == "" {
+		return ""
+	}
+	link := fmt.Sprintf("%sarchives/%s/p%s", h.teamURL, channel, strings.ReplaceAll(ts, ".", ""))
+	if thread != "" && thread != ts {
+		link += fmt.Sprintf("?thread_ts=%s&cid=%s", thread, channel)
+	}
+	return link
+}
+
+// timestamp returns the time of the timestamp of the message.
+func timestamp(ts string) time.Time {
+	sec, nsec, _ := strings.Cut(ts, ".")
+	s, _ := strconv.ParseInt(sec, 10, 64)
+	n, _ := strconv.ParseInt((nsec + "000000000")[:9], 10, 64)
+	return time.Unix(s, n)
+}
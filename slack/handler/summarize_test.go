@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/yuanying/myao/model/summary"
+)
+
+func TestWantsSummary(t *testing.T) {
+	h := &Handler{summarizer: &summary.Summarizer{}}
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{text: "<@U0BOT> summarize this thread", want: true},
+		{text: "<@U0BOT> can you recap the channel?", want: true},
+		{text: "<@U0BOT> recap <#C0123|general>", want: true},
+		{text: "<@U0BOT> summarize the last 3 hours", want: true},
+		{text: "<@U0BOT> tl;dr of the discussion please", want: true},
+		{text: "<@U0BOT> このスレッドを要約して", want: true},
+		{text: "<@U0BOT> 3時間分まとめて", want: true},
+		{text: "<@U0BOT> give me a summary of Go generics", want: false},
+		{text: "<@U0BOT> summarize the plot of Hamlet", want: false},
+		{text: "<@U0BOT> recap <#C9999|random>", want: false},
+		{text: "<@U0BOT> summarize this thread https://example.com/article", want: false},
+		{text: "<@U0BOT> what did we talk about in this thread?", want: false},
+	}
+	for _, tt := range tests {
+		if got := h.wantsSummary(tt.text, "C0123"); got != tt.want {
+			t.Errorf("wantsSummary(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+	if (&Handler{}).wantsSummary("summarize this thread", "C0123") {
+		t.Errorf("wantsSummary() is true without the summarizer")
+	}
+}
+
+func TestSummaryHours(t *testing.T) {
+	h := &Handler{defaultSummaryHours: 24}
+	tests := []struct {
+		text string
+		want int
+	}{
+		{text: "<@U0BOT> /summarize", want: 24},
+		{text: "<@U0BOT> /summarize 6", want: 6},
+		{text: "<@U04AB12CD3H> /summarize 6", want: 6},
+		{text: "<@U04AB12CD3H> summarize this thread", want: 24},
+		{text: "<@U0BOT> /summarize 6 of the last 3 days", want: 6},
+		{text: "<@U0BOT> summarize the last 3 hours", want: 3},
+		{text: "<@U0BOT> recap the last 2 days", want: 48},
+		{text: "<@U0BOT> recap <#C12H|general> today", want: 24},
+		{text: "<@U0BOT> 3時間分まとめて", want: 3},
+		{text: "<@U0BOT> /summarize 1000", want: maxSummaryHours},
+		{text: "<@U0BOT> /summarize 0", want: 24},
+	}
+	for _, tt := range tests {
+		if got := h.summaryHours(tt.text); got != tt.want {
+			t.Errorf("summaryHours(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
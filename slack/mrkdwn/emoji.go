@@ -0,0 +1,99 @@
+package mrkdwn
+
+// emoji are the characters of the common emoji codes of Slack.
+var emoji = map[string]string{
+	"+1":                            "👍",
+	"thumbsup":                      "👍",
+	"-1":                            "👎",
+	"thumbsdown":                    "👎",
+	"smile":                         "😄",
+	"smiley":                        "😃",
+	"grinning":                      "😀",
+	"laughing":                      "😆",
+	"joy":                           "😂",
+	"rolling_on_the_floor_laughing": "🤣",
+	"slightly_smiling_face":         "🙂",
+	"wink":                          "😉",
+	"blush":                         "😊",
+	"heart_eyes":                    "😍",
+	"thinking_face":                 "🤔",
+	"neutral_face":                  "😐",
+	"sweat_smile":                   "😅",
+	"sweat":                         "😓",
+	"cry":                           "😢",
+	"sob":                           "😭",
+	"angry":                         "😠",
+	"rage":                          "😡",
+	"scream":                        "😱",
+	"astonished":                    "😲",
+	"open_mouth":                    "😮",
+	"sleeping":                      "😴",
+	"sunglasses":                    "😎",
+	"innocent":                      "😇",
+	"upside_down_face":              "🙃",
+	"relieved":                      "😌",
+	"pray":                          "🙏",
+	"clap":                          "👏",
+	"raised_hands":                  "🙌",
+	"wave":                          "👋",
+	"ok_hand":                       "👌",
+	"muscle":                        "💪",
+	"eyes":                          "👀",
+	"bow":                           "🙇",
+	"heart":                         "❤️",
+	"broken_heart":                  "💔",
+	"sparkles":                      "✨",
+	"star":                          "⭐",
+	"fire":                          "🔥",
+	"tada":                          "🎉",
+	"100":                           "💯",
+	"rocket":                        "🚀",
+	"white_check_mark":              "✅",
+	"heavy_check_mark":              "✔️",
+	"x":                             "❌",
+	"o":                             "⭕",
+	"warning":                       "⚠️",
+	"question":                      "❓",
+	"exclamation":                   "❗",
+	"bulb":                          "💡",
+	"memo":                          "📝",
+	"pencil2":                       "✏️",
+	"books":                         "📚",
+	"coffee":                        "☕",
+	"beer":                          "🍺",
+	"sushi":                         "🍣",
+	"ramen":                         "🍜",
+	"cat":                           "🐱",
+	"smile_cat":                     "😸",
+	"dog":                           "🐶",
+	"sunny":                         "☀️",
+	"cloud":                         "☁️",
+	"umbrella":                      "☔",
+	"snowflake":                     "❄️",
+	"zzz":                           "💤",
+	"running":                       "🏃",
+	"runner":                        "🏃",
+	"computer":                      "💻",
+	"bug":                           "🐛",
+	"gear":                          "⚙️",
+	"lock":                          "🔒",
+	"key":                           "🔑",
+	"calendar":                      "📆",
+	"hourglass":                     "⌛",
+	"point_up":                      "☝️",
+	"point_right":                   "👉",
+	"see_no_evil":                   "🙈",
+	"party_popper":                  "🎉",
+	"partying_face":                 "🥳",
+	"face_with_rolling_eyes":        "🙄",
+	"grimacing":                     "😬",
+	"hugging_face":                  "🤗",
+	"star-struck":                   "🤩",
+	"confused":                      "😕",
+	"disappointed":                  "😞",
+	"weary":                         "😩",
+	"tired_face":                    "😫",
+	"yum":                           "😋",
+	"stuck_out_tongue":              "😛",
+	"kissing_heart":                 "😘",
+}
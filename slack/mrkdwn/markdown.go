@@ -0,0 +1,193 @@
+package mrkdwn
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+var (
+	emojiRegexp = regexp.MustCompile(`:([a-z0-9_+\-]+):`)
+	// The styles of mrkdwn only apply to the words surrounded by the spaces or the punctuations.
+	boldRegexp   = regexp.MustCompile(`(^|[\s(\[])\*([^*\s](?:[^*\n]*[^*\s])?)\*([\s)\].,!?:;]|$)`)
+	italicRegexp = regexp.MustCompile(`(^|[\s(\[])_([^_\s](?:[^_\n]*[^_\s])?)_([\s)\].,!?:;]|$)`)
+	strikeRegexp = regexp.MustCompile(`(^|[\s(\[])~([^~\s](?:[^~\n]*[^~\s])?)~([\s)\].,!?:;]|$)`)
+)
+
+// ToMarkdown converts the text of a Slack message into Markdown.
+// The code blocks and the inline code are kept as they are.
+func ToMarkdown(text string, r *Resolver) string {
+	return mapCode(text, func(s string) string {
+		s = Unescape(s, r)
+		// Apply twice because adjacent matches share the spaces between them.
+		// The bold is converted first not to take the converted italics as the bold.
+		for _, style := range []struct {
+			re   *regexp.Regexp
+			repl string
+		}{
+			{boldRegexp, "$1**$2**$3"},
+			{italicRegexp, "$1*$2*$3"},
+			{strikeRegexp, "$1~~$2~~$3"},
+		} {
+			s = style.re.ReplaceAllString(style.re.ReplaceAllString(s, style.repl), style.repl)
+		}
+		return Emoji(s)
+	}, func(code string) string {
+		return entityReplacer.Replace(code)
+	})
+}
+
+// Emoji converts the emoji codes such as :smile: into the characters. The unknown codes are kept.
+func Emoji(text string) string {
+	return emojiRegexp.ReplaceAllStringFunc(text, func(code string) string {
+		if e, ok := emoji[code[1:len(code)-1]]; ok {
+			return e
+		}
+		return code
+	})
+}
+
+// mapCode applies text to the parts out of the code, and code to the code blocks and the inline code.
+func mapCode(s string, text, code func(string) string) string {
+	var b strings.Builder
+	for s != "" {
+		i := strings.Index(s, "`")
+		if i < 0 {
+			b.WriteString(text(s))
+			break
+		}
+		b.WriteString(text(s[:i]))
+		s = s[i:]
+		fence := "`"
+		if strings.HasPrefix(s, "```") {
+			fence = "```"
+		}
+		end := strings.Index(s[len(fence):], fence)
+		if end < 0 {
+			b.WriteString(text(s))
+			break
+		}
+		end += 2 * len(fence)
+		b.WriteString(fence + code(s[len(fence):end-len(fence)]) + fence)
+		s = s[end:]
+	}
+	return b.String()
+}
+
+// FromBlocks converts the rich_text blocks of a Slack message into Markdown.
+// It returns false if the message has no rich_text block.
+func FromBlocks(blocks slack.Blocks, r *Resolver) (string, bool) {
+	var (
+		parts []string
+		found bool
+	)
+	for _, block := range blocks.BlockSet {
+		rich, ok := block.(*slack.RichTextBlock)
+		if !ok {
+			continue
+		}
+		found = true
+		for _, e := range rich.Elements {
+			parts = append(parts, richText(e, r))
+		}
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n")), found
+}
+
+func richText(e slack.RichTextElement, r *Resolver) string {
+	switch e := e.(type) {
+	case *slack.RichTextSection:
+		return sectionText(e.Elements, r)
+	case *slack.RichTextQuote:
+		return "> " + strings.ReplaceAll(sectionText(e.Elements, r), "\n", "\n> ") + "\n"
+	case *slack.RichTextPreformatted:
+		var b strings.Builder
+		for _, s := range e.Elements {
+			b.WriteString(plainText(s, r))
+		}
+		return "```\n" + strings.TrimSuffix(b.String(), "\n") + "\n```\n"
+	case *slack.RichTextList:
+		var lines []string
+		indent := strings.Repeat("  ", e.Indent)
+		for i, item := range e.Elements {
+			marker := "-"
+			if e.Style == slack.RTEListOrdered {
+				marker = fmt.Sprintf("%d.", i+1)
+			}
+			lines = append(lines, fmt.Sprintf("%s%s %s", indent, marker, strings.TrimSpace(richText(item, r))))
+		}
+		return strings.Join(lines, "\n")
+	}
+	return ""
+}
+
+func sectionText(elements []slack.RichTextSectionElement, r *Resolver) string {
+	var b strings.Builder
+	for _, s := range elements {
+		switch s := s.(type) {
+		case *slack.RichTextSectionTextElement:
+			b.WriteString(styled(s.Text, s.Style))
+		case *slack.RichTextSectionLinkElement:
+			if s.Text == "" || s.Text == s.URL {
+				b.WriteString(s.URL)
+			} else {
+				fmt.Fprintf(&b, "[%s](%s)", s.Text, s.URL)
+			}
+		default:
+			b.WriteString(plainText(s, r))
+		}
+	}
+	return b.String()
+}
+
+// plainText returns the text of the element without the styles.
+func plainText(e slack.RichTextSectionElement, r *Resolver) string {
+	switch e := e.(type) {
+	case *slack.RichTextSectionTextElement:
+		return e.Text
+	case *slack.RichTextSectionLinkElement:
+		if e.Text != "" {
+			return e.Text
+		}
+		return e.URL
+	case *slack.RichTextSectionUserElement:
+		return Unescape("<@"+e.UserID+">", r)
+	case *slack.RichTextSectionChannelElement:
+		return Unescape("<#"+e.ChannelID+">", r)
+	case *slack.RichTextSectionUserGroupElement:
+		return "@" + e.UsergroupID
+	case *slack.RichTextSectionBroadcastElement:
+		return "@" + e.Range
+	case *slack.RichTextSectionEmojiElement:
+		return Emoji(":" + e.Name + ":")
+	case *slack.RichTextSectionDateElement:
+		return time.Unix(int64(e.Timestamp), 0).Format("2006-01-02 15:04")
+	}
+	return ""
+}
+
+func styled(text string, style *slack.RichTextSectionTextStyle) string {
+	if style == nil || strings.TrimSpace(text) == "" {
+		return text
+	}
+	// Keep the spaces out of the markers, which Markdown doesn't allow inside.
+	lead := text[:len(text)-len(strings.TrimLeft(text, " "))]
+	trail := text[len(strings.TrimRight(text, " ")):]
+	text = strings.TrimSpace(text)
+	if style.Code {
+		return lead + "`" + text + "`" + trail
+	}
+	if style.Strike {
+		text = "~~" + text + "~~"
+	}
+	if style.Italic {
+		text = "*" + text + "*"
+	}
+	if style.Bold {
+		text = "**" + text + "**"
+	}
+	return lead + text + trail
+}
@@ -0,0 +1,139 @@
+package mrkdwn
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+var testResolver = &Resolver{
+	User: func(id string) string {
+		return map[string]string{"U1": "Taro"}[id]
+	},
+	Channel: func(id string) string {
+		return map[string]string{"C1": "general"}[id]
+	},
+}
+
+func TestFromMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want string
+		// back is the Markdown converted back from the mrkdwn, or md itself if empty.
+		back string
+	}{
+		{name: "plain", md: "Hello, world!", want: "Hello, world!"},
+		{name: "link", md: "See [the docs](https://example.com/a?b=c&d=e).", want: "See <https://example.com/a?b=c&amp;d=e|the docs>.", back: "See the docs (https://example.com/a?b=c&d=e)."},
+		{name: "bare link", md: "<https://example.com>", want: "&lt;https://example.com&gt;"},
+		{name: "bold", md: "This is **bold**.", want: "This is *bold*."},
+		{name: "italic", md: "This is *italic* and _this_ too.", want: "This is _italic_ and _this_ too.", back: "This is *italic* and *this* too."},
+		{name: "bold italic", md: "***both***", want: "*_both_*", back: "**_both_**"},
+		{name: "strike", md: "~~gone~~", want: "~gone~"},
+		{name: "bold in code", md: "Use `**kwargs` here", want: "Use `**kwargs` here"},
+		{name: "heading", md: "## **Setup** steps", want: "*Setup steps*", back: "**Setup steps**"},
+		{name: "list", md: "- one\n- **two**\n  * nested", want: "• one\n• *two*\n  • nested", back: "• one\n• **two**\n  • nested"},
+		{name: "numbered list", md: "1. one\n2. two", want: "1. one\n2. two"},
+		{name: "quote", md: "> quoted *text*", want: "> quoted _text_"},
+		{name: "code fence", md: "```go\nx := a * b * c\n// <b>\n```", want: "```\nx := a * b * c\n// <b>\n```", back: "```\nx := a * b * c\n// <b>\n```"},
+		{name: "mention markup", md: "<@U1> & <!channel>", want: "&lt;@U1&gt; &amp; &lt;!channel&gt;"},
+		{name: "table", md: "| a | bb |\n|---|---|\n| ccc | d |", want: "```\na   | bb\nccc | d\n```", back: "```\na   | bb\nccc | d\n```"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FromMarkdown(tt.md)
+			if got != tt.want {
+				t.Errorf("FromMarkdown(%q) = %q, want %q", tt.md, got, tt.want)
+			}
+			back := tt.back
+			if back == "" {
+				back = tt.md
+			}
+			if md := ToMarkdown(got, testResolver); md != back {
+				t.Errorf("ToMarkdown(%q) = %q, want %q", got, md, back)
+			}
+		})
+	}
+}
+
+func TestToMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "mentions", text: "<@U1> in <#C1> and <#C2|random>", want: "@Taro in #general and #random"},
+		{name: "unknown user", text: "<@U9|jiro> <@U8>", want: "@jiro <@U8>"},
+		{name: "links", text: "<https://example.com|docs> <https://example.com> <mailto:a@example.com|a@example.com>", want: "docs (https://example.com) https://example.com a@example.com"},
+		{name: "broadcast", text: "<!here> <!subteam^S1|@devs>", want: "@here @devs"},
+		{name: "styles", text: "*bold* _italic_ ~strike~ *a* *b*", want: "**bold** *italic* ~~strike~~ **a** **b**"},
+		{name: "not styles", text: "2*3*4 snake_case_name", want: "2*3*4 snake_case_name"},
+		{name: "entities", text: "a &lt; b &amp;&amp; c &gt; d", want: "a < b && c > d"},
+		{name: "code", text: "`*x* &lt; y` and ```\n_a_ &amp; <@U1>\n```", want: "`*x* < y` and ```\n_a_ & <@U1>\n```"},
+		{name: "emoji", text: "nice :+1: :unknown_emoji:", want: "nice 👍 :unknown_emoji:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToMarkdown(tt.text, testResolver); got != tt.want {
+				t.Errorf("ToMarkdown(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromBlocks(t *testing.T) {
+	tests := []struct {
+		name   string
+		blocks string
+		want   string
+	}{
+		{
+			name: "styles and links",
+			blocks: `[{"type":"rich_text","elements":[{"type":"rich_text_section","elements":[
+				{"type":"text","text":"Hi "},{"type":"user","user_id":"U1"},{"type":"text","text":", "},
+				{"type":"text","text":"bold ","style":{"bold":true}},{"type":"text","text":"italic","style":{"italic":true}},
+				{"type":"text","text":" see "},{"type":"link","url":"https://example.com","text":"docs"},
+				{"type":"text","text":" "},{"type":"link","url":"https://example.com"},
+				{"type":"text","text":" "},{"type":"text","text":"x*y","style":{"code":true}}]}]}]`,
+			want: "Hi @Taro, **bold** *italic* see [docs](https://example.com) https://example.com `x*y`",
+		},
+		{
+			name: "lists",
+			blocks: `[{"type":"rich_text","elements":[
+				{"type":"rich_text_list","style":"bullet","indent":0,"elements":[
+					{"type":"rich_text_section","elements":[{"type":"text","text":"one"}]},
+					{"type":"rich_text_section","elements":[{"type":"text","text":"two"}]}]},
+				{"type":"rich_text_list","style":"ordered","indent":1,"elements":[
+					{"type":"rich_text_section","elements":[{"type":"text","text":"first"}]}]}]}]`,
+			want: "- one\n- two\n  1. first",
+		},
+		{
+			name: "code block and quote",
+			blocks: `[{"type":"rich_text","elements":[
+				{"type":"rich_text_preformatted","elements":[{"type":"text","text":"if a < b {\n}"}]},
+				{"type":"rich_text_quote","elements":[{"type":"text","text":"quoted\nlines"}]}]}]`,
+			want: "```\nif a < b {\n}\n```\n\n> quoted\n> lines",
+		},
+		{
+			name:   "no rich text",
+			blocks: `[{"type":"divider"}]`,
+			want:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var blocks slack.Blocks
+			if err := json.Unmarshal([]byte(tt.blocks), &blocks); err != nil {
+				t.Fatal(err)
+			}
+			got, ok := FromBlocks(blocks, testResolver)
+			if ok != (tt.want != "") {
+				t.Errorf("FromBlocks() ok = %v", ok)
+			}
+			if got != tt.want {
+				t.Errorf("FromBlocks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
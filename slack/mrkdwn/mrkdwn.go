@@ -0,0 +1,76 @@
+package mrkdwn
+
+import (
+	"regexp"
+	"strings"
+)
+
+// controlRegexp matches the control sequences of Slack, e.g. <@U123>, <#C123|general> and <https://example.com|label>.
+var controlRegexp = regexp.MustCompile(`<([^<>]*)>`)
+
+var entityReplacer = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+
+// Resolver resolves the names of the users and the channels.
+// The labels in the messages are used if the names are empty.
+type Resolver struct {
+	User    func(id string) string
+	Channel func(id string) string
+}
+
+// Unescape converts the control sequences and the entities of a Slack message into plain text.
+// The users are written as @name, the channels as #name and the links as "label (url)".
+func Unescape(text string, r *Resolver) string {
+	text = controlRegexp.ReplaceAllStringFunc(text, func(seq string) string {
+		body := seq[1 : len(seq)-1]
+		target, label, _ := strings.Cut(body, "|")
+		switch {
+		case strings.HasPrefix(target, "@"):
+			if name := r.user(target[1:]); name != "" {
+				return "@" + name
+			}
+			if label != "" {
+				return "@" + strings.TrimPrefix(label, "@")
+			}
+			return seq
+		case strings.HasPrefix(target, "#"):
+			if name := r.channel(target[1:]); name != "" {
+				return "#" + name
+			}
+			if label != "" {
+				return "#" + label
+			}
+			return seq
+		case strings.HasPrefix(target, "!subteam^"):
+			if label != "" {
+				return "@" + strings.TrimPrefix(label, "@")
+			}
+			return "@" + strings.TrimPrefix(target, "!subteam^")
+		case target == "!here" || target == "!channel" || target == "!everyone":
+			return "@" + target[1:]
+		case strings.HasPrefix(target, "!date^"):
+			// <!date^1392734382^{date} at {time}|February 18th, 2014 at 6:39 AM PST>
+			return label
+		case strings.HasPrefix(target, "!"):
+			return label
+		case label == "" || label == target || "mailto:"+label == target:
+			return strings.TrimPrefix(target, "mailto:")
+		default:
+			return label + " (" + target + ")"
+		}
+	})
+	return entityReplacer.Replace(text)
+}
+
+func (r *Resolver) user(id string) string {
+	if r == nil || r.User == nil {
+		return ""
+	}
+	return r.User(id)
+}
+
+func (r *Resolver) channel(id string) string {
+	if r == nil || r.Channel == nil {
+		return ""
+	}
+	return r.Channel(id)
+}
@@ -0,0 +1,142 @@
+package mrkdwn
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	headingRegexp    = regexp.MustCompile(`^#{1,6}\s+(.*?)\s*#*$`)
+	bulletRegexp     = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	ruleRegexp       = regexp.MustCompile(`^\s*(?:-{3,}|\*{3,}|_{3,})\s*$`)
+	tableRowRegexp   = regexp.MustCompile(`^\s*\|.*\|\s*$`)
+	tableSepRegexp   = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(?:\|\s*:?-+:?\s*)*\|?\s*$`)
+	imageRegexp      = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+	linkRegexp       = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	boldItalicRegexp = regexp.MustCompile(`\*\*\*([^*\n]+)\*\*\*`)
+	mdBoldRegexp     = regexp.MustCompile(`\*\*([^*\n]+)\*\*|__([^_\n]+)__`)
+	mdItalicRegexp   = regexp.MustCompile(`(^|[^*\w])\*([^*\s](?:[^*\n]*[^*\s])?)\*([^*\w]|$)`)
+	mdStrikeRegexp   = regexp.MustCompile(`~~([^~\n]+)~~`)
+)
+
+// FromMarkdown converts the Markdown written by the model into Slack mrkdwn.
+// The tables are rendered as the aligned code blocks because mrkdwn has no table.
+func FromMarkdown(md string) string {
+	var (
+		out   []string
+		table []string
+		code  bool
+	)
+	flush := func() {
+		if len(table) > 0 {
+			out = append(out, tableText(table))
+			table = nil
+		}
+	}
+	for _, line := range strings.Split(md, "\n") {
+		if isFence(line) {
+			flush()
+			code = !code
+			// Slack shows the language of the fence as the code.
+			out = append(out, "```")
+			continue
+		}
+		if code {
+			out = append(out, line)
+			continue
+		}
+		if tableRowRegexp.MatchString(line) {
+			table = append(table, line)
+			continue
+		}
+		flush()
+		out = append(out, lineText(line))
+	}
+	flush()
+	return strings.Join(out, "\n")
+}
+
+func lineText(line string) string {
+	switch {
+	case ruleRegexp.MatchString(line):
+		return "──────────"
+	case headingRegexp.MatchString(line):
+		return "*" + inlineText(headingRegexp.FindStringSubmatch(line)[1], true) + "*"
+	case bulletRegexp.MatchString(line):
+		m := bulletRegexp.FindStringSubmatch(line)
+		return m[1] + "• " + inlineText(m[2], false)
+	}
+	quote := ""
+	if strings.HasPrefix(line, ">") {
+		quote, line = ">", line[1:]
+	}
+	return quote + inlineText(line, false)
+}
+
+// inlineText converts the inline styles out of the inline code. The bold is dropped in the headings, which are bold.
+func inlineText(s string, heading bool) string {
+	return mapCode(s, func(s string) string {
+		s = Escape(s)
+		s = imageRegexp.ReplaceAllString(s, "<$2|$1>")
+		s = linkRegexp.ReplaceAllString(s, "<$2|$1>")
+		bold := "*"
+		if heading {
+			bold = ""
+		}
+		// The italics are converted first because the bold of mrkdwn is the italics of Markdown.
+		s = mdItalicRegexp.ReplaceAllString(s, "${1}_${2}_${3}")
+		s = boldItalicRegexp.ReplaceAllString(s, bold+"_${1}_"+bold)
+		s = mdBoldRegexp.ReplaceAllStringFunc(s, func(m string) string {
+			return bold + m[2:len(m)-2] + bold
+		})
+		return mdStrikeRegexp.ReplaceAllString(s, "~$1~")
+	}, func(code string) string {
+		return code
+	})
+}
+
+// Escape escapes the characters of the control sequences of Slack, e.g. the mentions.
+func Escape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// tableText renders the rows of a Markdown table as a code block with the aligned columns.
+func tableText(rows []string) string {
+	var (
+		cells  [][]string
+		widths []int
+	)
+	for _, row := range rows {
+		if tableSepRegexp.MatchString(row) {
+			continue
+		}
+		row = strings.TrimSpace(row)
+		cols := strings.Split(strings.Trim(row, "|"), "|")
+		for i := range cols {
+			cols[i] = strings.TrimSpace(cols[i])
+			w := utf8.RuneCountInString(cols[i])
+			if i >= len(widths) {
+				widths = append(widths, w)
+			} else if w > widths[i] {
+				widths[i] = w
+			}
+		}
+		cells = append(cells, cols)
+	}
+	lines := []string{"```"}
+	for _, cols := range cells {
+		var b strings.Builder
+		for i, col := range cols {
+			if i > 0 {
+				b.WriteString(" | ")
+			}
+			b.WriteString(col)
+			if i < len(cols)-1 {
+				b.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(col)))
+			}
+		}
+		lines = append(lines, b.String())
+	}
+	return strings.Join(append(lines, "```"), "\n")
+}
@@ -0,0 +1,214 @@
+package mrkdwn
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Part is a part of a reply, either the text in mrkdwn or a snippet.
+type Part struct {
+	Text    string
+	Snippet *Snippet
+}
+
+// Snippet is a long code block to be uploaded as a file.
+type Snippet struct {
+	Filename string
+	Code     string
+}
+
+// extensions are the file extensions of the languages of the code fences.
+var extensions = map[string]string{
+	"bash":       "sh",
+	"c":          "c",
+	"c++":        "cpp",
+	"cpp":        "cpp",
+	"css":        "css",
+	"diff":       "diff",
+	"go":         "go",
+	"html":       "html",
+	"java":       "java",
+	"javascript": "js",
+	"js":         "js",
+	"json":       "json",
+	"markdown":   "md",
+	"md":         "md",
+	"py":         "py",
+	"python":     "py",
+	"rb":         "rb",
+	"ruby":       "rb",
+	"rust":       "rs",
+	"sh":         "sh",
+	"shell":      "sh",
+	"sql":        "sql",
+	"ts":         "ts",
+	"typescript": "ts",
+	"yaml":       "yaml",
+	"yml":        "yaml",
+}
+
+// Render converts the Markdown reply into the parts in mrkdwn.
+// The code blocks longer than snippetLines lines are cut out as the snippets, unless snippetLines is zero.
+func Render(md string, snippetLines int) []Part {
+	var (
+		parts []Part
+		text  []string
+		fence = -1
+	)
+	addText := func(lines []string) {
+		if s := strings.TrimSpace(strings.Join(lines, "\n")); s != "" {
+			parts = append(parts, Part{Text: FromMarkdown(s)})
+		}
+	}
+	for _, line := range strings.Split(md, "\n") {
+		text = append(text, line)
+		if !isFence(line) {
+			continue
+		}
+		if fence < 0 {
+			fence = len(text) - 1
+			continue
+		}
+		code := text[fence+1 : len(text)-1]
+		if snippetLines > 0 && len(code) > snippetLines {
+			addText(text[:fence])
+			lang := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text[fence]), "```")))
+			ext, ok := extensions[lang]
+			if !ok {
+				ext = "txt"
+			}
+			parts = append(parts, Part{Snippet: &Snippet{Filename: "snippet." + ext, Code: strings.Join(code, "\n")}})
+			text = nil
+		}
+		fence = -1
+	}
+	addText(text)
+	return parts
+}
+
+// Split splits the mrkdwn text into the chunks within limit characters.
+// The text is split at the paragraphs, and the code blocks split across the chunks are closed and reopened.
+func Split(text string, limit int) []string {
+	var (
+		chunks []string
+		b      strings.Builder
+		size   int
+	)
+	for _, paragraph := range paragraphs(text) {
+		for _, piece := range cut(paragraph, limit) {
+			n := utf8.RuneCountInString(piece)
+			if size > 0 && size+2+n > limit {
+				chunks = append(chunks, b.String())
+				b.Reset()
+				size = 0
+			}
+			if size > 0 {
+				b.WriteString("\n\n")
+				size += 2
+			}
+			b.WriteString(piece)
+			size += n
+		}
+	}
+	if size > 0 {
+		chunks = append(chunks, b.String())
+	}
+	return chunks
+}
+
+// paragraphs splits the text at the blank lines out of the code blocks.
+func paragraphs(text string) []string {
+	var (
+		paragraphs []string
+		lines      []string
+		code       bool
+	)
+	for _, line := range strings.Split(text, "\n") {
+		if isFence(line) {
+			code = !code
+		}
+		if !code && strings.TrimSpace(line) == "" {
+			if len(lines) > 0 {
+				paragraphs = append(paragraphs, strings.Join(lines, "\n"))
+				lines = nil
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) > 0 {
+		paragraphs = append(paragraphs, strings.Join(lines, "\n"))
+	}
+	return paragraphs
+}
+
+// cut cuts the paragraph longer than limit at the lines.
+func cut(paragraph string, limit int) []string {
+	if utf8.RuneCountInString(paragraph) <= limit {
+		return []string{paragraph}
+	}
+	const closing = "\n```"
+	var (
+		pieces []string
+		lines  []string
+		size   int
+		// base is the size of the fence reopening the code block in the piece.
+		base int
+		code bool
+	)
+	flush := func() {
+		if size > base {
+			piece := strings.Join(lines, "\n")
+			if code {
+				piece += closing
+			}
+			pieces = append(pieces, piece)
+		}
+		lines, size, base = nil, 0, 0
+		if code {
+			lines, size, base = []string{"```"}, 3, 3
+		}
+	}
+	for _, line := range strings.Split(paragraph, "\n") {
+		fence := isFence(line)
+		for i, l := range cutRunes(line, limit-2*len(closing)) {
+			// The fence toggles the code block at its first piece, and the rest of the line is in the block.
+			after := code != (fence && i == 0)
+			reserve := 0
+			if after {
+				reserve = len(closing)
+			}
+			n := utf8.RuneCountInString(l)
+			if size > 0 && size+1+n+reserve > limit {
+				flush()
+			}
+			if size > 0 {
+				size++
+			}
+			lines = append(lines, l)
+			size += n
+			code = after
+		}
+	}
+	flush()
+	return pieces
+}
+
+// cutRunes cuts the line into the pieces within n runes, preferably at the spaces.
+func cutRunes(line string, n int) []string {
+	var pieces []string
+	for utf8.RuneCountInString(line) > n {
+		runes := []rune(line)
+		i := n
+		if j := strings.LastIndex(string(runes[:n]), " "); j > 0 && utf8.RuneCountInString(line[:j]) > n/2 {
+			i = utf8.RuneCountInString(line[:j])
+		}
+		pieces = append(pieces, string(runes[:i]))
+		line = strings.TrimLeft(string(runes[i:]), " ")
+	}
+	return append(pieces, line)
+}
+
+func isFence(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "```")
+}
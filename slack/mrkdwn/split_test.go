@@ -0,0 +1,100 @@
+package mrkdwn
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{
+			name:  "short",
+			text:  "hello",
+			limit: 20,
+			want:  []string{"hello"},
+		},
+		{
+			name:  "paragraphs",
+			text:  "aaaa aaaa\n\nbbbb bbbb\n\ncccc",
+			limit: 20,
+			want:  []string{"aaaa aaaa\n\nbbbb bbbb", "cccc"},
+		},
+		{
+			name:  "long line",
+			text:  "aaaa bbbb cccc dddd eeee",
+			limit: 20,
+			want:  []string{"aaaa bbbb\ncccc dddd", "eeee"},
+		},
+		{
+			name:  "code block is closed and reopened",
+			text:  "```\naaaa\nbbbb\ncccc\n```",
+			limit: 17,
+			want:  []string{"```\naaaa\nbbbb\n```", "```\ncccc\n```"},
+		},
+		{
+			name:  "blank lines in code block",
+			text:  "```\na\n\nb\n```",
+			limit: 20,
+			want:  []string{"```\na\n\nb\n```"},
+		},
+		{
+			name:  "long closing fence",
+			text:  "```\nb\n```cccccccccccccccccccccccc\nd",
+			limit: 12,
+		},
+		{
+			name:  "long opening fence",
+			text:  "```aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa\nbbbbbbbbbbbb bbbbbbbbbb\n```",
+			limit: 12,
+		},
+		{
+			name:  "fences only",
+			text:  "```\n```\n```\n```\n```\n```\n```",
+			limit: 12,
+		},
+		{
+			name:  "unclosed fence",
+			text:  "```\naaaaaaaa\nbbbbbbbb\ncccccccc",
+			limit: 12,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Split(tt.text, tt.limit)
+			if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Split() = %q, want %q", got, tt.want)
+			}
+			for _, chunk := range got {
+				if n := utf8.RuneCountInString(chunk); n > tt.limit {
+					t.Errorf("chunk has %v characters over %v: %q", n, tt.limit, chunk)
+				}
+			}
+		})
+	}
+}
+
+func FuzzSplit(f *testing.F) {
+	f.Add("```\n```cccccccccccccccccccc\nd", 12)
+	f.Add("a\n\n```go\nb\n```", 20)
+	f.Fuzz(func(t *testing.T, text string, limit int) {
+		// The limit leaves room for the fences closing and reopening the code blocks.
+		if limit < 12 || limit > 200 {
+			return
+		}
+		for _, chunk := range Split(text, limit) {
+			if n := utf8.RuneCountInString(chunk); n > limit {
+				t.Fatalf("chunk has %v characters over %v: %q", n, limit, chunk)
+			}
+			if strings.TrimSpace(chunk) == "" {
+				t.Fatalf("chunk is empty: %q", chunk)
+			}
+		}
+	})
+}
@@ -0,0 +1,212 @@
+package policy
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/klog/v2"
+)
+
+// Policy decides whether and when the bot joins a conversation it wasn't mentioned in.
+type Policy struct {
+	// ReplyProbability is the chance (0.0-1.0) that the bot replies to a message.
+	ReplyProbability float64 `yaml:"replyProbability"`
+	// MinReplyGap is the minimum time between two replies of the bot in the channel.
+	MinReplyGap time.Duration `yaml:"minReplyGap"`
+	// OnlyOnQuestions makes the bot reply only to questions.
+	OnlyOnQuestions bool `yaml:"onlyOnQuestions"`
+	// OnlyOnMention makes the bot reply only when it's mentioned.
+	OnlyOnMention bool `yaml:"onlyOnMention"`
+	// SilenceWindow is how long the channel must stay silent before the bot replies.
+	// A random delay up to the max delay reply period is used if empty.
+	SilenceWindow time.Duration `yaml:"silenceWindow"`
+	// QuietHours is the time range the bot doesn't speak unless it's mentioned.
+	QuietHours *QuietHours `yaml:"quietHours"`
+}
+
+type QuietHours struct {
+	// Start and End are formatted as "15:04".
+	Start    string `yaml:"start"`
+	End      string `yaml:"end"`
+	Timezone string `yaml:"timezone"`
+
+	start, end time.Duration
+	location   *time.Location
+}
+
+type Config struct {
+	Default  Policy               `yaml:"default"`
+	Channels map[string]yaml.Node `yaml:"channels"`
+}
+
+// Engine evaluates the policies and tracks the replies of the bot per channel.
+type Engine struct {
+	maxDelay time.Duration
+	def      *Policy
+	channels map[string]*Policy
+
+	// mu protects lastReply from concurrent access.
+	mu        sync.Mutex
+	lastReply map[string]time.Time
+}
+
+// New loads the policies from file. The bot replies to every message after a random delay if file is empty.
+func New(file string, maxDelay time.Duration) (*Engine, error) {
+	config := &Config{
+		Default: Policy{ReplyProbability: 1.0},
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(data, config); err != nil {
+			return nil, err
+		}
+	}
+
+	e := &Engine{
+		maxDelay:  maxDelay,
+		def:       &config.Default,
+		channels:  map[string]*Policy{},
+		lastReply: map[string]time.Time{},
+	}
+	if err := e.def.init(); err != nil {
+		return nil, fmt.Errorf("default: %v", err)
+	}
+	for channel, node := range config.Channels {
+		p := config.Default
+		if config.Default.QuietHours != nil {
+			// The channels override the quiet hours of their own copy.
+			q := *config.Default.QuietHours
+			p.QuietHours = &q
+		}
+		if err := node.Decode(&p); err != nil {
+			return nil, fmt.Errorf("channel %v: %v", channel, err)
+		}
+		if err := p.init(); err != nil {
+			return nil, fmt.Errorf("channel %v: %v", channel, err)
+		}
+		e.channels[channel] = &p
+	}
+	return e, nil
+}
+
+func (p *Policy) init() error {
+	if p.ReplyProbability < 0 || p.ReplyProbability > 1 {
+		return fmt.Errorf("replyProbability must be between 0 and 1: %v", p.ReplyProbability)
+	}
+	if p.QuietHours != nil {
+		return p.QuietHours.init()
+	}
+	return nil
+}
+
+func (q *QuietHours) init() (err error) {
+	q.location = time.Local
+	if q.Timezone != "" {
+		if q.location, err = time.LoadLocation(q.Timezone); err != nil {
+			return err
+		}
+	}
+	if q.start, err = parseClock(q.Start); err != nil {
+		return err
+	}
+	if q.end, err = parseClock(q.End); err != nil {
+		return err
+	}
+	return nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of quietHours: %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether now is in the quiet hours.
+func (q *QuietHours) Contains(now time.Time) bool {
+	now = now.In(q.location)
+	clock := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	if q.start <= q.end {
+		return q.start <= clock && clock < q.end
+	}
+	// The quiet hours span midnight.
+	return q.start <= clock || clock < q.end
+}
+
+// For returns the policy of the channel.
+func (e *Engine) For(channel string) *Policy {
+	if p, ok := e.channels[channel]; ok {
+		return p
+	}
+	return e.def
+}
+
+// Engage decides whether the bot should reply to the unmentioned message,
+// and returns how long it should wait for the channel to be silent before replying.
+func (e *Engine) Engage(channel, text string, now time.Time) (time.Duration, bool) {
+	p := e.For(channel)
+	if p.OnlyOnMention {
+		klog.Infof("Policy: %v accepts only mentions", channel)
+		return 0, false
+	}
+	if p.QuietHours != nil && p.QuietHours.Contains(now) {
+		klog.Infof("Policy: %v is in quiet hours", channel)
+		return 0, false
+	}
+	if p.OnlyOnQuestions && !isQuestion(text) {
+		klog.Infof("Policy: %v accepts only questions", channel)
+		return 0, false
+	}
+	if rand.Float64() >= p.ReplyProbability {
+		klog.Infof("Policy: %v skipped by reply probability %v", channel, p.ReplyProbability)
+		return 0, false
+	}
+	if !e.gapElapsed(channel, p, now) {
+		return 0, false
+	}
+
+	if p.SilenceWindow > 0 {
+		return p.SilenceWindow, true
+	}
+	if e.maxDelay <= 0 {
+		return 0, true
+	}
+	return time.Duration(rand.Int63n(int64(e.maxDelay))), true
+}
+
+// Ready reports whether enough time has passed since the last reply in the channel.
+func (e *Engine) Ready(channel string, now time.Time) bool {
+	return e.gapElapsed(channel, e.For(channel), now)
+}
+
+// Replied records that the bot replied in the channel.
+func (e *Engine) Replied(channel string, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastReply[channel] = now
+}
+
+func (e *Engine) gapElapsed(channel string, p *Policy, now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	last, ok := e.lastReply[channel]
+	if ok && now.Sub(last) < p.MinReplyGap {
+		klog.Infof("Policy: %v replied %v ago", channel, now.Sub(last))
+		return false
+	}
+	return true
+}
+
+func isQuestion(text string) bool {
+	text = strings.TrimSpace(text)
+	return strings.ContainsAny(text, "?？") || strings.HasSuffix(text, "か")
+}
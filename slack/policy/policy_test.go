@@ -0,0 +1,89 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	config := `
+default:
+  replyProbability: 0.5
+  quietHours:
+    start: "22:00"
+    end: "07:00"
+    timezone: UTC
+channels:
+  night:
+    quietHours:
+      start: "01:00"
+      end: "05:00"
+  day:
+    replyProbability: 0.8
+    quietHours:
+      start: "12:00"
+      end: "13:00"
+  inherit:
+    onlyOnQuestions: true
+  noisy:
+    quietHours: null
+`
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := New(file, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(clock string) time.Time {
+		c, err := time.Parse("15:04", clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Date(2024, 1, 1, c.Hour(), c.Minute(), 0, 0, time.UTC)
+	}
+	tests := []struct {
+		channel     string
+		probability float64
+		questions   bool
+		quiet       []string
+		loud        []string
+	}{
+		{channel: "unknown", probability: 0.5, quiet: []string{"23:00", "06:59"}, loud: []string{"07:00", "12:30"}},
+		{channel: "night", probability: 0.5, quiet: []string{"01:00", "04:59"}, loud: []string{"23:00", "12:30"}},
+		{channel: "day", probability: 0.8, quiet: []string{"12:30"}, loud: []string{"23:00", "02:00"}},
+		{channel: "inherit", probability: 0.5, questions: true, quiet: []string{"23:00"}, loud: []string{"12:30"}},
+		{channel: "noisy", probability: 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.channel, func(t *testing.T) {
+			p := e.For(tt.channel)
+			if p.ReplyProbability != tt.probability {
+				t.Errorf("ReplyProbability = %v, want %v", p.ReplyProbability, tt.probability)
+			}
+			if p.OnlyOnQuestions != tt.questions {
+				t.Errorf("OnlyOnQuestions = %v, want %v", p.OnlyOnQuestions, tt.questions)
+			}
+			if tt.quiet == nil && tt.loud == nil {
+				if p.QuietHours != nil {
+					t.Errorf("QuietHours = %+v, want nil", p.QuietHours)
+				}
+				return
+			}
+			for _, clock := range tt.quiet {
+				if !p.QuietHours.Contains(at(clock)) {
+					t.Errorf("%v isn't in quiet hours", clock)
+				}
+			}
+			for _, clock := range tt.loud {
+				if p.QuietHours.Contains(at(clock)) {
+					t.Errorf("%v is in quiet hours", clock)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package profiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"k8s.io/klog/v2"
+
+	"github.com/yuanying/myao/model"
+	"github.com/yuanying/myao/model/configs"
+	"github.com/yuanying/myao/slack/users"
+)
+
+const (
+	profilerCharacter = "profiler"
+	profilesFile      = "profiles.json"
+	// maxPending is the number of the messages of a user which updates the profile without waiting for the idle time.
+	maxPending = 20
+	// checkInterval is the interval to check the users idle.
+	checkInterval = time.Minute
+)
+
+// Profile is what the bot knows about a member.
+type Profile struct {
+	// PreferredName is the name the member wants to be called by.
+	PreferredName string   `json:"preferredName,omitempty"`
+	Language      string   `json:"language,omitempty"`
+	Interests     []string `json:"interests,omitempty"`
+	// Facts are what the member told about themselves.
+	Facts []string `json:"facts,omitempty"`
+	// EnglishLevel is the CEFR level of the English of the member, e.g. "B1".
+	EnglishLevel string    `json:"englishLevel,omitempty"`
+	Updated      time.Time `json:"updated"`
+	// Forgotten is true if the member asked to forget the profile, and the messages aren't profiled anymore.
+	Forgotten bool `json:"forgotten,omitempty"`
+}
+
+// Text returns the profile in the Markdown list, or empty if nothing is known.
+func (p *Profile) Text() string {
+	if p == nil {
+		return ""
+	}
+	var lines []string
+	add := func(label, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			lines = append(lines, fmt.Sprintf("- %s: %s", label, value))
+		}
+	}
+	add("Preferred name", p.PreferredName)
+	add("Language", p.Language)
+	add("Interests", strings.Join(p.Interests, ", "))
+	add("English level", p.EnglishLevel)
+	for _, fact := range p.Facts {
+		add("Fact", fact)
+	}
+	return strings.Join(lines, "\n")
+}
+
+type Opts struct {
+	PersistentDir string
+	Users         *users.Users
+	// Idle is the time since the last message of a user after which the profile is updated.
+	Idle time.Duration
+}
+
+// Profiler keeps the profiles of the members in profiles.json in the persistent dir.
+// The messages of the members are kept in memory, and the profiler character updates the profiles by them
+// when the members are idle.
+type Profiler struct {
+	opts  *Opts
+	model *model.Shared
+
+	// mu protects profiles and pending from concurrent access.
+	mu       sync.Mutex
+	profiles map[string]*Profile
+	pending  map[string]*pending
+}
+
+// pending are the messages of a user not reflected in the profile yet.
+type pending struct {
+	messages []string
+	last     time.Time
+}
+
+func New(opts *model.Opts, profileOpts *Opts) (*Profiler, error) {
+	config, err := configs.Load(profilerCharacter)
+	if err != nil {
+		return nil, err
+	}
+	opts.Overrides.Apply(config)
+	p := &Profiler{
+		opts: profileOpts,
+		model: &model.Shared{
+			Config: config,
+			OpenAI: model.NewOpenAIClient(opts),
+			Opts:   opts,
+		},
+		profiles: map[string]*Profile{},
+		pending:  map[string]*pending{},
+	}
+	p.load()
+	return p, nil
+}
+
+// Get returns the profile of the user, or nil if unknown.
+func (p *Profiler) Get(user string) *Profile {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	profile, ok := p.profiles[user]
+	if !ok || profile.Forgotten {
+		return nil
+	}
+	copied := *profile
+	return &copied
+}
+
+// Observe keeps the message of the user to update the profile later, unless the user asked to forget it.
+func (p *Profiler) Observe(user, text string) {
+	if p == nil || user == "" || strings.TrimSpace(text) == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if profile, ok := p.profiles[user]; ok && profile.Forgotten {
+		return
+	}
+	q, ok := p.pending[user]
+	if !ok {
+		q = &pending{}
+		p.pending[user] = q
+	}
+	q.messages = append(q.messages, text)
+	if len(q.messages) > 2*maxPending {
+		q.messages = q.messages[len(q.messages)-2*maxPending:]
+	}
+	q.last = time.Now()
+}
+
+// Forget removes the profile and the messages of the user, and stops profiling the user until Remember.
+// It returns false if nothing is known.
+func (p *Profiler) Forget(user string) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	profile, ok := p.profiles[user]
+	known := (ok && !profile.Forgotten) || p.pending[user] != nil
+	// The marker is a new profile, so the updates in progress see the change and drop the profiles.
+	p.profiles[user] = &Profile{Forgotten: true, Updated: time.Now()}
+	delete(p.pending, user)
+	p.save()
+	return known
+}
+
+// Remember starts profiling the user forgotten again.
+func (p *Profiler) Remember(user string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if profile, ok := p.profiles[user]; ok && profile.Forgotten {
+		delete(p.profiles, user)
+		p.save()
+	}
+}
+
+// Run updates the profiles of the users idle until ctx is done.
+func (p *Profiler) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for user, messages := range p.take(time.Now()) {
+			if err := p.update(ctx, user, messages); err != nil {
+				klog.Errorf("Failed to update profile: %v, %v", user, err)
+			}
+		}
+	}
+}
+
+// take returns the messages of the users idle or having many messages, and removes them from pending.
+func (p *Profiler) take(now time.Time) map[string][]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	taken := map[string][]string{}
+	for user, q := range p.pending {
+		if now.Sub(q.last) >= p.opts.Idle || len(q.messages) >= maxPending {
+			taken[user] = q.messages
+			delete(p.pending, user)
+		}
+	}
+	return taken
+}
+
+// update asks the profiler character to update the profile of the user by the messages.
+func (p *Profiler) update(ctx context.Context, user string, messages []string) error {
+	member, ok := p.opts.Users.Get(user)
+	if !ok {
+		// Bots and deleted users don't have profiles.
+		return nil
+	}
+	p.mu.Lock()
+	read := p.profiles[user]
+	p.mu.Unlock()
+	if read != nil && read.Forgotten {
+		return nil
+	}
+	profile := &Profile{}
+	if read != nil {
+		profile = read
+	}
+	current, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	request := []openai.ChatCompletionMessage{
+		{Role: "system", Content: p.model.RenderSystemText(p.model.Vars(ctx))},
+		{Role: "user", Content: fmt.Sprintf("# Current profile of %s:\n%s\n\n# Messages of %s:\n- %s",
+			member.Name, current, member.Name, strings.Join(messages, "\n- "))},
+	}
+	output, err := p.model.ChatCompletions(ctx, request)
+	if err != nil {
+		return err
+	}
+	profile = &Profile{}
+	if err := json.Unmarshal([]byte(output.Choices[0].Message.Content), profile); err != nil {
+		return fmt.Errorf("invalid profile: %w", err)
+	}
+	profile.Updated = time.Now()
+	profile.Forgotten = false
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.profiles[user] != read {
+		// The profile was forgotten or updated while asking the profiler.
+		klog.Infof("Profile is changed during the update, dropped: %v", member.Name)
+		return nil
+	}
+	p.profiles[user] = profile
+	p.save()
+	klog.Infof("Profile is updated: %v, %v", member.Name, profile.Text())
+	return nil
+}
+
+// save writes the profiles. mu must be held.
+func (p *Profiler) save() {
+	data, err := json.Marshal(p.profiles)
+	if err != nil {
+		klog.Errorf("Failed to marshal profiles: %v", err)
+		return
+	}
+	if err := os.WriteFile(p.file(), data, 0644); err != nil {
+		klog.Errorf("Failed to write profiles: %v", err)
+	}
+}
+
+func (p *Profiler) load() {
+	data, err := os.ReadFile(p.file())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.Errorf("Failed to read profiles: %v", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &p.profiles); err != nil {
+		klog.Errorf("Failed to parse profiles: %v", err)
+	}
+}
+
+func (p *Profiler) file() string {
+	return filepath.Join(p.opts.PersistentDir, profilesFile)
+}
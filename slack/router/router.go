@@ -0,0 +1,140 @@
+package router
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/yuanying/myao/model/configs"
+	"github.com/yuanying/myao/slack/channels"
+)
+
+// Rule matches a channel by its ID or by a name pattern, and binds it to a character.
+type Rule struct {
+	Channel string `yaml:"channel"`
+	// Name is a channel name pattern in path.Match syntax, e.g. "english-*".
+	Name string `yaml:"name"`
+	// Character answers in the matched channel. The default character is used if empty.
+	Character string `yaml:"character"`
+	// Deny makes the bot ignore the matched channel.
+	Deny bool `yaml:"deny"`
+	// Schedules are the posts of the character in the channel started by itself. Channel is required.
+	Schedules []*configs.Schedule `yaml:"schedules"`
+}
+
+type Config struct {
+	// Default is the character for channels that don't match any rule.
+	Default string `yaml:"default"`
+	// DenyUnmatched makes the bot ignore channels that don't match any rule.
+	DenyUnmatched bool   `yaml:"denyUnmatched"`
+	Rules         []Rule `yaml:"rules"`
+}
+
+// Router decides which character answers in a channel.
+type Router struct {
+	config   *Config
+	channels *channels.Channels
+}
+
+// New loads the routing rules from file. Every channel is bound to character if file is empty.
+func New(channels *channels.Channels, file, character string) (*Router, error) {
+	config := &Config{}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(data, config); err != nil {
+			return nil, err
+		}
+	}
+	if config.Default == "" {
+		config.Default = character
+	}
+	for i, rule := range config.Rules {
+		if rule.Channel == "" && rule.Name == "" {
+			return nil, fmt.Errorf("rule %v: either channel or name is required", i)
+		}
+		if _, err := path.Match(rule.Name, ""); err != nil {
+			return nil, fmt.Errorf("rule %v: invalid name pattern %q: %v", i, rule.Name, err)
+		}
+		if len(rule.Schedules) > 0 && rule.Channel == "" {
+			return nil, fmt.Errorf("rule %v: channel is required for schedules", i)
+		}
+		for _, s := range rule.Schedules {
+			if s.Channel == "" {
+				s.Channel = rule.Channel
+			}
+		}
+	}
+
+	r := &Router{
+		config:   config,
+		channels: channels,
+	}
+	// A typo in the rules stops the bot instead of falling back to another character.
+	for _, c := range r.Characters() {
+		if _, err := configs.Load(c); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Characters returns all characters the rules refer to.
+func (r *Router) Characters() []string {
+	characters := []string{r.config.Default}
+	seen := map[string]bool{r.config.Default: true}
+	for _, rule := range r.config.Rules {
+		if rule.Deny || rule.Character == "" || seen[rule.Character] {
+			continue
+		}
+		seen[rule.Character] = true
+		characters = append(characters, rule.Character)
+	}
+	return characters
+}
+
+// Schedules returns the schedules of the rules by character.
+func (r *Router) Schedules() map[string][]*configs.Schedule {
+	schedules := map[string][]*configs.Schedule{}
+	for _, rule := range r.config.Rules {
+		character := rule.Character
+		if character == "" {
+			character = r.config.Default
+		}
+		schedules[character] = append(schedules[character], rule.Schedules...)
+	}
+	return schedules
+}
+
+// Route returns the character that answers in the channel, or false if the channel is denied.
+func (r *Router) Route(channel string) (string, bool) {
+	var name string
+	for _, rule := range r.config.Rules {
+		if rule.Channel != "" && rule.Channel != channel {
+			continue
+		}
+		if rule.Name != "" {
+			if name == "" {
+				name = r.channels.Get(channel).Name
+			}
+			if ok, _ := path.Match(rule.Name, name); !ok {
+				continue
+			}
+		}
+		if rule.Deny {
+			return "", false
+		}
+		if rule.Character == "" {
+			return r.config.Default, true
+		}
+		return rule.Character, true
+	}
+	if r.config.DenyUnmatched {
+		return "", false
+	}
+	return r.config.Default, true
+}
@@ -0,0 +1,212 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/yuanying/myao/model/configs"
+	"github.com/yuanying/myao/slack/channels"
+)
+
+const (
+	stateFile = "schedules.json"
+	claimsDir = "schedules"
+	// catchUp is the period to run the posts missed while the bot is down.
+	catchUp = time.Hour
+	// claimRetention is the period to keep the claims of the posts.
+	claimRetention = 7 * 24 * time.Hour
+)
+
+var unsafeRegexp = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// Job is a schedule of a character.
+type Job struct {
+	Character string
+	Schedule  *configs.Schedule
+}
+
+type Opts struct {
+	PersistentDir string
+	Channels      *channels.Channels
+	Jobs          []*Job
+	// Post posts the reply of the character to the prompt of the schedule in the channel.
+	Post func(ctx context.Context, character, channel string, schedule *configs.Schedule) error
+}
+
+// Scheduler posts by the schedules of the characters.
+// The last times of the posts are kept in the persistent dir to catch up the posts missed while the bot is down,
+// and each post is claimed by a file in the persistent dir so that the replicas sharing it don't post twice.
+type Scheduler struct {
+	opts *Opts
+	host string
+
+	// mu protects last from concurrent access.
+	mu sync.Mutex
+	// last are the times of the last posts by the schedule.
+	last map[string]time.Time
+}
+
+func New(opts *Opts) (*Scheduler, error) {
+	names := map[string]bool{}
+	for _, job := range opts.Jobs {
+		if job.Schedule.Name == "" {
+			return nil, fmt.Errorf("name of schedule of %v is required", job.Character)
+		}
+		if names[job.Schedule.Name] {
+			return nil, fmt.Errorf("schedule %v is duplicated", job.Schedule.Name)
+		}
+		names[job.Schedule.Name] = true
+	}
+	if err := os.MkdirAll(filepath.Join(opts.PersistentDir, claimsDir), 0755); err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	s := &Scheduler{
+		opts: opts,
+		host: fmt.Sprintf("%v/%v", host, os.Getpid()),
+		last: map[string]time.Time{},
+	}
+	s.load()
+	return s, nil
+}
+
+// Run runs the schedules until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	if len(s.opts.Jobs) == 0 {
+		return
+	}
+	for _, job := range s.opts.Jobs {
+		go s.run(ctx, job)
+	}
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+	for {
+		s.cleanup(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, job *Job) {
+	name := job.Schedule.Name
+	now := time.Now()
+	next := job.Schedule.Next(now)
+	s.mu.Lock()
+	last, ok := s.last[name]
+	s.mu.Unlock()
+	if missed := job.Schedule.Next(last); ok && missed.Before(now) && now.Sub(missed) < catchUp {
+		klog.Infof("Catch up the schedule missed: %v, %v", name, missed)
+		next = missed
+	}
+	for {
+		klog.Infof("Next post of %v at %v", name, next)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		s.post(ctx, job, next)
+		next = job.Schedule.Next(time.Now())
+	}
+}
+
+// post posts by the schedule at the time unless another replica has claimed it.
+func (s *Scheduler) post(ctx context.Context, job *Job, at time.Time) {
+	name := job.Schedule.Name
+	defer s.done(name, at)
+	if !s.claim(name, at) {
+		klog.Infof("Schedule is posted by another replica: %v, %v", name, at)
+		return
+	}
+	channel := job.Schedule.Channel
+	if strings.HasPrefix(channel, "#") {
+		id, ok := s.opts.Channels.Find(channel[1:])
+		if !ok {
+			klog.Errorf("Channel of schedule isn't found: %v, %v", name, channel)
+			return
+		}
+		channel = id
+	}
+	klog.Infof("Post by schedule: %v, %v", name, channel)
+	if err := s.opts.Post(ctx, job.Character, channel, job.Schedule); err != nil {
+		klog.Errorf("Failed to post by schedule: %v, %v", name, err)
+	}
+}
+
+// claim creates the claim file of the post, and returns false if it already exists.
+func (s *Scheduler) claim(name string, at time.Time) bool {
+	file := filepath.Join(s.opts.PersistentDir, claimsDir, fmt.Sprintf("%s-%d.lock", unsafeRegexp.ReplaceAllString(name, "_"), at.Unix()))
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		if !os.IsExist(err) {
+			klog.Errorf("Failed to claim schedule: %v", err)
+		}
+		return false
+	}
+	defer f.Close()
+	f.WriteString(s.host)
+	return true
+}
+
+// cleanup removes the claims older than claimRetention.
+func (s *Scheduler) cleanup(now time.Time) {
+	dir := filepath.Join(s.opts.PersistentDir, claimsDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		klog.Errorf("Failed to read claims: %v", err)
+		return
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || now.Sub(info.ModTime()) < claimRetention {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil && !os.IsNotExist(err) {
+			klog.Errorf("Failed to remove claim: %v", err)
+		}
+	}
+}
+
+// done records the time of the post, which is posted by this replica or another.
+func (s *Scheduler) done(name string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last[name] = at
+	data, err := json.Marshal(s.last)
+	if err != nil {
+		klog.Errorf("Failed to marshal schedules: %v", err)
+		return
+	}
+	if err := os.WriteFile(s.file(), data, 0644); err != nil {
+		klog.Errorf("Failed to write schedules: %v", err)
+	}
+}
+
+func (s *Scheduler) load() {
+	data, err := os.ReadFile(s.file())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.Errorf("Failed to read schedules: %v", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &s.last); err != nil {
+		klog.Errorf("Failed to parse schedules: %v", err)
+	}
+}
+
+func (s *Scheduler) file() string {
+	return filepath.Join(s.opts.PersistentDir, stateFile)
+}
@@ -0,0 +1,247 @@
+package tutor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"k8s.io/klog/v2"
+
+	"github.com/yuanying/myao/model/correction"
+	"github.com/yuanying/myao/model/quiz"
+)
+
+const (
+	DeliveryDM     = "dm"
+	DeliveryThread = "thread"
+
+	// sessionTTL is how long the quizzes wait for the answers.
+	// The sessions expired are removed when the next quizzes are delivered.
+	sessionTTL = 12 * time.Hour
+)
+
+type Opts struct {
+	Slack  *slack.Client
+	Deck   *quiz.Deck
+	Grader *quiz.Grader
+	// Delivery is either "dm" or "thread". The quizzes are disabled if empty.
+	Delivery string
+	// Channel is the channel to post the daily thread of the quizzes in.
+	Channel string
+	// Time is the local time of the day to deliver the quizzes in "15:04" format.
+	Time string
+	// Size is the number of the quizzes per user per day.
+	Size int
+}
+
+// Tutor delivers the quizzes made from the past corrections every day, and grades the answers.
+type Tutor struct {
+	opts *Opts
+	hour int
+	min  int
+
+	// mu protects sessions from concurrent access.
+	mu sync.Mutex
+	// sessions are the quizzes in progress by the conversation and the user.
+	sessions map[sessionKey]*session
+}
+
+// sessionKey identifies the quizzes of a user. thread is empty in DMs.
+type sessionKey struct {
+	channel string
+	thread  string
+	user    string
+}
+
+type session struct {
+	questions []*quiz.Question
+	total     int
+	grading   bool
+	created   time.Time
+}
+
+// New returns nil if the quizzes are disabled.
+func New(opts *Opts) (*Tutor, error) {
+	switch opts.Delivery {
+	case "":
+		return nil, nil
+	case DeliveryDM:
+	case DeliveryThread:
+		if opts.Channel == "" {
+			return nil, fmt.Errorf("channel of the quiz thread is required")
+		}
+	default:
+		return nil, fmt.Errorf("unknown quiz delivery: %v", opts.Delivery)
+	}
+	t, err := time.Parse("15:04", opts.Time)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quiz time: %w", err)
+	}
+	if opts.Size <= 0 {
+		opts.Size = 1
+	}
+	return &Tutor{
+		opts:     opts,
+		hour:     t.Hour(),
+		min:      t.Minute(),
+		sessions: map[sessionKey]*session{},
+	}, nil
+}
+
+// Learn makes the card of the correction of the message of user.
+func (t *Tutor) Learn(user string, c *correction.Correction) {
+	if t == nil {
+		return
+	}
+	t.opts.Deck.Add(user, c, time.Now())
+}
+
+// Run delivers the quizzes at the time every day until ctx is done.
+func (t *Tutor) Run(ctx context.Context) {
+	for {
+		now := time.Now()
+		next := time.Date(now.Year(), now.Month(), now.Day(), t.hour, t.min, 0, 0, time.Local)
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+		klog.Infof("Next quizzes at %v", next)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+			t.Deliver(time.Now())
+		}
+	}
+}
+
+// Deliver starts the quizzes of the users having the cards due at now.
+func (t *Tutor) Deliver(now time.Time) {
+	t.expire(now)
+	users := t.opts.Deck.Users(now)
+	if len(users) == 0 {
+		return
+	}
+
+	var thread string
+	if t.opts.Delivery == DeliveryThread {
+		_, ts, err := t.opts.Slack.PostMessage(t.opts.Channel, slack.MsgOptionText(
+			"*Today's English review!* :pencil2:\nReply to your quiz in this thread.", false))
+		if err != nil {
+			klog.Errorf("Failed to post the quiz thread: %v", err)
+			return
+		}
+		thread = ts
+	}
+
+	for _, user := range users {
+		key := sessionKey{channel: t.opts.Channel, thread: thread, user: user}
+		intro := fmt.Sprintf("<@%s> Here is your review of the mistakes you made before.", user)
+		if t.opts.Delivery == DeliveryDM {
+			channel, _, _, err := t.opts.Slack.OpenConversation(&slack.OpenConversationParameters{Users: []string{user}})
+			if err != nil {
+				klog.Errorf("Failed to open DM: %v, %v", user, err)
+				continue
+			}
+			key.channel = channel.ID
+			intro = "Time for your English review! Reply with your answers."
+		}
+
+		s := &session{created: now}
+		for _, card := range t.opts.Deck.Due(user, now, t.opts.Size) {
+			s.questions = append(s.questions, quiz.NewQuestion(card))
+		}
+		s.total = len(s.questions)
+		t.mu.Lock()
+		t.sessions[key] = s
+		t.mu.Unlock()
+		t.post(key, fmt.Sprintf("%s\n\n%s", intro, t.questionText(s)))
+	}
+}
+
+// Answer grades the message if it's an answer to the quiz in progress, and returns true if so.
+func (t *Tutor) Answer(ctx context.Context, event *slackevents.MessageEvent) bool {
+	if t == nil {
+		return false
+	}
+	key := sessionKey{channel: event.Channel, thread: event.ThreadTimeStamp, user: event.User}
+	if event.ChannelType == "im" {
+		key.thread = ""
+	}
+
+	t.mu.Lock()
+	s, ok := t.sessions[key]
+	if !ok || s.grading {
+		t.mu.Unlock()
+		return ok
+	}
+	s.grading = true
+	// The question is copied because the session can be replaced by the next delivery while grading.
+	question := *s.questions[0]
+	q := &question
+	t.mu.Unlock()
+
+	go func() {
+		grade, err := t.opts.Grader.Grade(ctx, q, event.Text)
+		if err != nil {
+			klog.Errorf("Failed to grade: %v", err)
+		}
+		t.opts.Deck.Review(event.User, q.Card.ID, grade.Quality, time.Now())
+
+		mark := ":o:"
+		if !grade.Correct() {
+			mark = ":x:"
+		}
+		text := fmt.Sprintf("%s %s", mark, grade.Feedback)
+		if !grade.Correct() {
+			text += fmt.Sprintf("\n> %s", q.Card.Corrected)
+		}
+
+		t.mu.Lock()
+		if t.sessions[key] != s {
+			t.mu.Unlock()
+			klog.Infof("Quiz session is expired while grading: %v", key.user)
+			t.post(key, text)
+			return
+		}
+		s.grading = false
+		s.questions = s.questions[1:]
+		if len(s.questions) == 0 {
+			delete(t.sessions, key)
+			text += "\n\nThat's all for today. Great work! :tada:"
+		} else {
+			text += "\n\n" + t.questionText(s)
+		}
+		t.mu.Unlock()
+		t.post(key, text)
+	}()
+	return true
+}
+
+// expire removes the sessions not finished within sessionTTL.
+func (t *Tutor) expire(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, s := range t.sessions {
+		if now.Sub(s.created) >= sessionTTL {
+			klog.Infof("Quiz session is expired: %v", key.user)
+			delete(t.sessions, key)
+		}
+	}
+}
+
+func (t *Tutor) questionText(s *session) string {
+	return fmt.Sprintf("Q%d/%d. %s", s.total-len(s.questions)+1, s.total, s.questions[0].Text)
+}
+
+func (t *Tutor) post(key sessionKey, text string) {
+	msgOpts := []slack.MsgOption{slack.MsgOptionText(text, false)}
+	if key.thread != "" {
+		msgOpts = append(msgOpts, slack.MsgOptionTS(key.thread))
+	}
+	if _, _, err := t.opts.Slack.PostMessage(key.channel, msgOpts...); err != nil {
+		klog.Errorf("Slack post message error: %v", err)
+	}
+}
@@ -1,52 +1,312 @@
 package users
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/slack-go/slack"
-	"github.com/slack-go/slack/slackevents"
-	"github.com/yuanying/myao/model"
 	"k8s.io/klog/v2"
 )
 
+const (
+	usersFile = "users.json"
+	// retryUnknown is the period not to look up the users failed to be resolved again.
+	retryUnknown = 10 * time.Minute
+)
+
+// User is a member of the workspace.
+type User struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Title string `json:"title"`
+}
+
+// UserChangeEvent is the user_change event, which slackevents doesn't support.
+type UserChangeEvent struct {
+	Type string      `json:"type"`
+	User *slack.User `json:"user"`
+}
+
+// Users is the directory of the members, refreshed by the events and periodically, and cached in the disk.
 type Users struct {
-	Users map[string]string
+	slack *slack.Client
+	dir   string
+
+	// mu protects users and unknown from concurrent access.
+	mu    sync.RWMutex
+	users map[string]*User
+	// unknown are the times the users failed to be resolved.
+	unknown map[string]time.Time
+}
+
+// New loads the members from the cache, and refreshes them.
+// It fails only if the members can't be loaded from neither Slack nor the cache.
+func New(ctx context.Context, client *slack.Client, persistentDir string) (*Users, error) {
+	u := &Users{
+		slack:   client,
+		dir:     persistentDir,
+		users:   map[string]*User{},
+		unknown: map[string]time.Time{},
+	}
+	cached := u.load()
+	if err := u.Refresh(ctx); err != nil {
+		if !cached {
+			return nil, err
+		}
+		klog.Warningf("Use the cached users: %v", err)
+	}
+	return u, nil
 }
 
-func New(client *slack.Client) (*Users, error) {
-	res, err := client.GetUsers()
+// Refresh fetches all members page by page.
+// The members are replaced only if all pages are fetched.
+func (u *Users) Refresh(ctx context.Context) error {
+	users := map[string]*User{}
+	p := u.slack.GetUsersPaginated()
+	for {
+		// The pagination returned with an error has lost the cursor, so the page is fetched again by p.
+		next, err := p.Next(ctx)
+		if p.Done(err) {
+			break
+		}
+		if rateLimited, ok := err.(*slack.RateLimitedError); ok {
+			klog.Warningf("Users are rate limited, retry in %v", rateLimited.RetryAfter)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(rateLimited.RetryAfter):
+				continue
+			}
+		}
+		if err != nil {
+			klog.Errorf("Failed to get users: %v", err)
+			return err
+		}
+		p = next
+		for i := range p.Users {
+			if user := newUser(&p.Users[i]); user != nil {
+				users[user.ID] = user
+			}
+		}
+	}
+	klog.Infof("Users found: %v", len(users))
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.users = users
+	u.unknown = map[string]time.Time{}
+	u.save()
+	return nil
+}
+
+// Run refreshes the members every interval until ctx is done.
+func (u *Users) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			u.Refresh(ctx)
+		}
+	}
+}
+
+// Update updates the member by the user_change or team_join event.
+func (u *Users) Update(user *slack.User) {
+	if user == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if v := newUser(user); v != nil {
+		klog.Infof("User updated: %v, %v", v.ID, v.Name)
+		u.users[v.ID] = v
+	} else {
+		delete(u.users, user.ID)
+	}
+	delete(u.unknown, user.ID)
+	u.save()
+}
+
+// Get returns the member, looking up the unknown one by users.info.
+func (u *Users) Get(id string) (User, bool) {
+	u.mu.RLock()
+	user, ok := u.users[id]
+	failed, unknown := u.unknown[id]
+	u.mu.RUnlock()
+	if ok {
+		return *user, true
+	}
+	if id == "" || (unknown && time.Since(failed) < retryUnknown) {
+		return User{}, false
+	}
+
+	info, err := u.slack.GetUserInfo(id)
+	u.mu.Lock()
+	defer u.mu.Unlock()
 	if err != nil {
-		klog.Errorf("Failed to get users: %v", err)
-		return nil, err
+		klog.Errorf("Failed to get user info: %v, %v", id, err)
+		u.unknown[id] = time.Now()
+		return User{}, false
 	}
+	user = newUser(info)
+	if user == nil {
+		u.unknown[id] = time.Now()
+		return User{}, false
+	}
+	klog.Infof("User found: %v, %v", user.ID, user.Name)
+	u.users[id] = user
+	u.save()
+	return *user, true
+}
 
-	users := map[string]string{}
-	for _, v := range res {
-		if !v.IsBot {
-			name := v.Profile.DisplayName
-			if name == "" {
-				name = v.Profile.RealName
+// Name returns the display name of the member, or empty if unknown.
+func (u *Users) Name(id string) string {
+	user, _ := u.Get(id)
+	return user.Name
+}
+
+// Title returns the title in the profile of the member, or empty if unknown.
+func (u *Users) Title(id string) string {
+	user, _ := u.Get(id)
+	return user.Title
+}
+
+// codeRegexp matches the code blocks and the code spans in mrkdwn.
+var codeRegexp = regexp.MustCompile("(?s)```.*?```|`[^`\n]*`")
+
+// Mentions converts the @names of the members in text into the mentions.
+// The names shared by several members, and the ones in the code, are left as they are.
+func (u *Users) Mentions(text string) string {
+	if !strings.Contains(text, "@") {
+		return text
+	}
+	u.mu.RLock()
+	ids := map[string]string{}
+	for _, user := range u.users {
+		if user.Name == "" {
+			continue
+		}
+		key := strings.ToLower(user.Name)
+		if _, ok := ids[key]; ok {
+			ids[key] = ""
+			continue
+		}
+		ids[key] = user.ID
+	}
+	u.mu.RUnlock()
+	names := make([]string, 0, len(ids))
+	for name := range ids {
+		names = append(names, name)
+	}
+	// The longest name is matched first, e.g. "taro yamada" before "taro".
+	sort.Slice(names, func(i, j int) bool {
+		return len(names[i]) > len(names[j])
+	})
+
+	var b strings.Builder
+	for _, loc := range codeRegexp.FindAllStringIndex(text, -1) {
+		b.WriteString(mentions(text[:loc[0]], names, ids))
+		b.WriteString(text[loc[0]:loc[1]])
+		text = text[loc[1]:]
+	}
+	b.WriteString(mentions(text, names, ids))
+	return b.String()
+}
+
+// mentions converts the @names in text out of the code into the mentions of ids, matching names in order.
+func mentions(text string, names []string, ids map[string]string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(text, "@")
+		if i < 0 {
+			b.WriteString(text)
+			return b.String()
+		}
+		b.WriteString(text[:i])
+		text = text[i+1:]
+		if s := b.String(); len(s) > 0 && isWordByte(s[len(s)-1]) {
+			// e.g. an email address.
+			b.WriteString("@")
+			continue
+		}
+		matched := false
+		for _, name := range names {
+			if len(text) < len(name) || !strings.EqualFold(text[:len(name)], name) {
+				continue
+			}
+			if len(text) > len(name) && isWordByte(text[len(name)]) {
+				continue
 			}
-			klog.Infof("User found: %v, %v", v.ID, name)
-			users[v.ID] = name
+			if id := ids[name]; id != "" {
+				fmt.Fprintf(&b, "<@%s>", id)
+				text = text[len(name):]
+				matched = true
+			}
+			break
+		}
+		if !matched {
+			b.WriteString("@")
 		}
 	}
+}
 
-	return &Users{
-		Users: users,
-	}, nil
+func isWordByte(c byte) bool {
+	return c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
 }
 
-func (u *Users) Text(myaoID string, myao model.Model, event *slackevents.MessageEvent) string {
-	text := event.Text
-	if user, exist := u.Users[event.User]; exist {
-		text = myao.FormatText(user, text)
-		// text = fmt.Sprintf(myao.Config.TextFormat, user, text)
+// newUser returns the member of the user, or nil if it's a bot or deleted.
+func newUser(v *slack.User) *User {
+	if v.IsBot || v.Deleted {
+		return nil
+	}
+	name := v.Profile.DisplayName
+	if name == "" {
+		name = v.Profile.RealName
+	}
+	if name == "" {
+		name = v.Name
 	}
-	for i, v := range u.Users {
-		text = strings.Replace(text, fmt.Sprintf("<@%v>", i), v, -1)
+	return &User{ID: v.ID, Name: name, Title: v.Profile.Title}
+}
+
+// load loads the members from the cache, and returns true if succeeded.
+func (u *Users) load() bool {
+	data, err := os.ReadFile(u.file())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.Errorf("Failed to read users: %v", err)
+		}
+		return false
 	}
-	text = strings.Replace(text, fmt.Sprintf("<@%v>", myaoID), myao.Name(), -1)
-	return text
+	if err := json.Unmarshal(data, &u.users); err != nil {
+		klog.Errorf("Failed to parse users: %v", err)
+		return false
+	}
+	return true
+}
+
+func (u *Users) save() {
+	data, err := json.Marshal(u.users)
+	if err != nil {
+		klog.Errorf("Failed to marshal users: %v", err)
+		return
+	}
+	if err := os.WriteFile(u.file(), data, 0644); err != nil {
+		klog.Errorf("Failed to write users: %v", err)
+	}
+}
+
+func (u *Users) file() string {
+	return filepath.Join(u.dir, usersFile)
 }
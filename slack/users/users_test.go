@@ -0,0 +1,57 @@
+package users
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yuanying/myao/slack/mrkdwn"
+)
+
+func TestMentions(t *testing.T) {
+	u := &Users{
+		users: map[string]*User{
+			"U1": {ID: "U1", Name: "Taro"},
+			"U2": {ID: "U2", Name: "Taro Yamada"},
+			"U3": {ID: "U3", Name: "太郎"},
+			"U4": {ID: "U4", Name: "Hanako"},
+			"U5": {ID: "U5", Name: "hanako"},
+			"U6": {ID: "U6", Name: ""},
+		},
+		unknown: map[string]time.Time{},
+	}
+	tests := []struct {
+		name string
+		text string
+		want string
+		// back is the text unescaped from the mentions, or the text itself if empty.
+		back string
+	}{
+		{name: "no mentions", text: "Hello!", want: "Hello!"},
+		{name: "name", text: "Hi @Taro!", want: "Hi <@U1>!"},
+		{name: "case insensitive", text: "Hi @taro.", want: "Hi <@U1>.", back: "Hi @Taro."},
+		{name: "longest name", text: "@Taro Yamada and @Taro", want: "<@U2> and <@U1>"},
+		{name: "substring of another word", text: "@Taroko is here", want: "@Taroko is here"},
+		{name: "multibyte name", text: "@太郎さん、こんにちは", want: "<@U3>さん、こんにちは"},
+		{name: "ambiguous name", text: "Hi @Hanako", want: "Hi @Hanako"},
+		{name: "unknown name", text: "Hi @nobody", want: "Hi @nobody"},
+		{name: "email", text: "taro@example.com", want: "taro@example.com"},
+		{name: "code span", text: "Run `@Taro` for @Taro", want: "Run `@Taro` for <@U1>"},
+		{name: "code block", text: "```\nping @Taro\n```\n@Taro", want: "```\nping @Taro\n```\n<@U1>"},
+	}
+	resolver := &mrkdwn.Resolver{User: u.Name}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := u.Mentions(tt.text)
+			if got != tt.want {
+				t.Fatalf("Mentions(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			back := tt.back
+			if back == "" {
+				back = tt.text
+			}
+			if text := mrkdwn.Unescape(got, resolver); text != back {
+				t.Errorf("Unescape(%q) = %q, want %q", got, text, back)
+			}
+		})
+	}
+}